@@ -16,10 +16,17 @@ package add
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/lwolf/kube-atlas/pkg/fetch"
+	"github.com/lwolf/kube-atlas/pkg/fileutil"
+	"github.com/lwolf/kube-atlas/pkg/lock"
 	"github.com/lwolf/kube-atlas/pkg/state"
 )
 
@@ -27,17 +34,24 @@ var (
 	chartName    string
 	chartVersion string
 	namespace    string
+	fromValues   bool
 )
 
 var (
 	addUsage = `Add command creates a predefined directory structure
-for the new package and optionally fetches helm chart.
+for the new package and adds the release to the kube-atlas.yaml,
+comments and formatting of the config are preserved.
+
+With --chart the chart is fetched into the package right away
+(unless it's a local chart, e.g. ./charts/app) and the fetched version
+is written to the config if --version wasn't set. Use --from-values to
+seed values/values.yaml with the default values of the chart.
 
 To initialize new package run:
 
 	$ kube-atlas add prometheus
 	$ kube-atlas add prometheus --chart stable/prometheus
-	$ kube-atlas add prometheus --chart stable/prometheus --version 8.8.8
+	$ kube-atlas add prometheus --chart stable/prometheus --version 8.8.8 --from-values
 
 or to add multiple at one step
 	$ kube-atlas add prometheus grafana
@@ -60,42 +74,121 @@ var CmdAdd = &cobra.Command{
 		if len(args) > 1 && (chartName != "" || chartVersion != "") {
 			log.Fatal().Msg("Unable to use `chart` and `version' keys with multiple arguments")
 		}
+		if fromValues && chartName == "" {
+			log.Fatal().Msg("--from-values requires --chart")
+		}
+		cfgFile := viper.ConfigFileUsed()
+		if cfgFile == "" {
+			log.Fatal().Msg("config file is required")
+		}
 		for _, pkg := range args {
+			plog := log.With().Str("pkg", pkg).Logger()
 			r := s.ReleaseByName(pkg)
-			if r == nil {
-				// package does not exists in the kube-atlas.yaml
-				r = &state.ReleaseSpec{Name: pkg}
-				log.Info().Str("pkg", pkg).Msg("New package is being added, add record to your kube-atlas.yaml")
-				if namespace == "" {
-					namespace = "%namespace%"
+			if r != nil {
+				plog.Info().Msg("package already exists in the config")
+				if chartName != "" {
+					plog.Warn().Msg("chart of the existing package is not changed, use fetch to update it")
 				}
-				if chartName == "" {
-					chartName = "%repo/chartName%"
+				plog.Info().Msg("Creating/Fixing directory structure for the package")
+				if err = r.InitDirs(&s.Defaults); err != nil {
+					plog.Error().Err(err).Msg("failed to create directories")
 				}
-				if chartVersion == "" {
-					chartVersion = "%chartVersion%"
+				continue
+			}
+			r = &state.ReleaseSpec{
+				Name:      pkg,
+				Namespace: namespace,
+				Chart:     chartName,
+				Version:   chartVersion,
+			}
+			if fromValues {
+				r.Values = []string{"values.yaml"}
+			}
+			// config entry goes first, lock file and vendored chart never
+			// refer to the release which is missing from the config
+			if err = state.AddRelease(cfgFile, *r); err != nil {
+				plog.Fatal().Err(err).Msg("failed to add release to the config")
+			}
+			plog.Info().Str("config", cfgFile).Msg("release was added to the config")
+			if r.Chart != "" && r.SourceType() != state.SourceTypeLocal {
+				if err = fetchChart(r, &s, cfgFile); err != nil {
+					plog.Fatal().Err(err).Msg("failed to fetch chart")
 				}
-				msg := fmt.Sprintf(`
-  - name: %s
-    namespace: %s
-    chart: %s
-    version: %s
-    manifests: []
-    values: []
-`, pkg, namespace, chartName, chartVersion)
-				log.Info().Msg(msg)
 			}
-			log.Info().Str("pkg", pkg).Msg("Creating/Fixing directory structure for the package")
-			err = r.InitDirs(&s.Defaults)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to create directories")
+			plog.Info().Msg("Creating/Fixing directory structure for the package")
+			if err = r.InitDirs(&s.Defaults); err != nil {
+				plog.Error().Err(err).Msg("failed to create directories")
+			}
+			if fromValues {
+				if err = seedValues(r, &s); err != nil {
+					plog.Fatal().Err(err).Msg("failed to seed values from the chart")
+				}
 			}
 		}
 	},
 }
 
+// fetchChart vendors chart of the new release and records it in the lock file,
+// version of the release in the config is set to the fetched one unless it
+// was requested explicitly
+func fetchChart(r *state.ReleaseSpec, s *state.ClusterSpec, cfgFile string) error {
+	lockPath := lock.PathFor(cfgFile)
+	lf, err := lock.Load(lockPath)
+	if err != nil {
+		return fmt.Errorf("failed to load lock file: %v", err)
+	}
+	entry, err := fetch.Release(r, s)
+	if err != nil {
+		return err
+	}
+	lf.Set(*entry)
+	if err = lf.Save(); err != nil {
+		return fmt.Errorf("failed to update lock file %s: %v", lockPath, err)
+	}
+	if r.Version == "" {
+		r.Version = entry.Version
+		if err = state.SetReleaseVersion(cfgFile, r.Name, r.Version); err != nil {
+			return fmt.Errorf("failed to write fetched version to the config: %v", err)
+		}
+	}
+	log.Info().Str("pkg", r.Name).Str("version", entry.Version).Msg("chart was fetched")
+	return nil
+}
+
+// seedValues copies default values of the chart to the values directory
+// of the package, existing values file is never overwritten
+func seedValues(r *state.ReleaseSpec, s *state.ClusterSpec) error {
+	chartPath, err := r.GetChartPath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	valuesPath, err := r.GetValuesPath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(valuesPath, "values.yaml")
+	if fileutil.Exists(dst) {
+		log.Warn().Str("pkg", r.Name).Str("file", dst).Msg("values file already exists, keeping it")
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if os.IsNotExist(err) {
+		log.Warn().Str("pkg", r.Name).Msg("chart has no default values")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(dst, data, 0644); err != nil {
+		return err
+	}
+	log.Info().Str("pkg", r.Name).Str("file", dst).Msg("values were seeded from the chart defaults")
+	return nil
+}
+
 func init() {
 	CmdAdd.Flags().StringVar(&chartName, "chart", "", "Name of the helm chart to fetch into package, e.g. stable/prometheus")
 	CmdAdd.Flags().StringVar(&chartVersion, "version", "", "Version of the helm chart to fetch into package, e.g. 8.11.4")
 	CmdAdd.Flags().StringVar(&namespace, "namespace", "", "Namespace, to add to the kube-atlas file")
+	CmdAdd.Flags().BoolVar(&fromValues, "from-values", false, "Seed values/values.yaml of the package with the default values of the chart")
 }
@@ -15,40 +15,75 @@
 package bootstrap
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/lwolf/kube-atlas/pkg/bootstrap"
+	"github.com/lwolf/kube-atlas/pkg/state"
 )
 
 var (
-	dir         string
 	interactive bool
+	clusterName string
+	force       bool
 )
 
-var initUsage = `Init command
+var initUsage = `Init command creates a new project: kube-atlas.yaml (or the file
+passed via --file) with commented defaults, source and release directories,
+and adds temporary artifacts to the .gitignore.
+
+Existing config is never overwritten unless --force is set.
+
+	$ kube-atlas init --cluster-name dev --source-path apps --release-path releases
+
+In the interactive mode it asks for the project directory and the cluster
+name and offers to import repositories from the helm repositories.yaml and
+releases (with their repositories) from the helmfile. Credentials of the
+imported repositories are never written to the config, they are read from
+<NAME>_USERNAME and <NAME>_PASSWORD environment variables instead.
+
+	$ kube-atlas init --interactive
 `
 
 // initCmd represents the init command
 var CmdInit = &cobra.Command{
-	Use:   "init",
-	Short: "Create a new kube-atlas.yaml file in the current directory",
-	Long:  initUsage,
+	Use:     "init",
+	Example: "\tkube-atlas init --cluster-name dev",
+	Short:   "Create a new kube-atlas.yaml file in the current directory",
+	Long:    initUsage,
+	Args:    cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Warn().Msg("init command is not yet implemented")
+		o := bootstrap.Options{
+			ConfigFile: viper.ConfigFileUsed(),
+			Force:      force,
+			Defaults: state.DefaultConfig{
+				ClusterName: clusterName,
+				SourcePath:  cmd.Flag("source-path").Value.String(),
+				ReleasePath: cmd.Flag("release-path").Value.String(),
+			},
+		}
 		if interactive {
-			bootstrap.Interactive()
+			if err := bootstrap.Interactive(o); err != nil {
+				log.Fatal().Err(err).Msg("failed to initialize project")
+			}
+			return
+		}
+		created, err := bootstrap.Execute(o)
+		for _, p := range created {
+			fmt.Fprintf(os.Stdout, "created %s\n", p)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to initialize project")
 		}
-		// else {
-		// bootstrap.Execute()
-		// }
 	},
 }
 
 func init() {
-
-	// Here you will define your flags and configuration settings.
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
 	CmdInit.Flags().BoolVar(&interactive, "interactive", false, "Start in interactive mode")
+	CmdInit.Flags().StringVar(&clusterName, "cluster-name", "dev", "Name of the cluster used by default")
+	CmdInit.Flags().BoolVar(&force, "force", false, "Overwrite existing config file")
 }
@@ -0,0 +1,119 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delete
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/lwolf/kube-atlas/pkg/lock"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var (
+	keepSource bool
+	dryRun     bool
+)
+
+var deleteUsage = `Delete command removes the release from kube-atlas.yaml (comments and
+formatting of the rest of the file are preserved) together with its
+package directory, rendered release directory and the lock file entry.
+
+Release directory shared with other releases (e.g. with the custom
+releasePathTemplate) is kept.
+
+	# show what would be removed
+	kube-atlas delete prometheus --dry-run
+
+	# remove the release but keep its chart, values and manifests
+	kube-atlas delete prometheus grafana --keep-source
+`
+
+// CmdDelete represents the delete command
+var CmdDelete = &cobra.Command{
+	Use:     "delete <name>...",
+	Aliases: []string{"rm"},
+	Example: "\tkube-atlas delete prometheus --dry-run",
+	Short:   "Remove one or more releases from the config and the disk",
+	Long:    deleteUsage,
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfgFile := viper.ConfigFileUsed()
+		if cfgFile == "" {
+			log.Fatal().Msg("config file is required")
+		}
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		// make sure that all the releases exist before removing anything
+		var releases []*state.ReleaseSpec
+		seen := make(map[string]bool)
+		for _, name := range args {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			r := s.ReleaseByName(name)
+			if r == nil {
+				log.Fatal().Str("release", name).Msg("failed to find release by name in the config")
+			}
+			releases = append(releases, r)
+		}
+		lf, err := lock.Load(lock.PathFor(cfgFile))
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load lock file")
+		}
+		for _, r := range releases {
+			rlog := log.With().Str("release", r.Name).Logger()
+			dirs, err := s.ReleaseDirectories(r, !keepSource)
+			if err != nil {
+				rlog.Fatal().Err(err).Msg("failed to get directories of the release")
+			}
+			if dryRun {
+				rlog.Info().Str("config", cfgFile).Msg("release would be removed from the config")
+				for _, d := range dirs {
+					rlog.Info().Str("path", d).Msg("directory would be removed")
+				}
+				continue
+			}
+			// config entry goes first, failure to remove it leaves the
+			// release untouched instead of pointing to the missing files
+			if err = state.RemoveRelease(cfgFile, r.Name); err != nil {
+				rlog.Fatal().Err(err).Msg("failed to remove release from the config")
+			}
+			rlog.Info().Str("config", cfgFile).Msg("release was removed from the config")
+			if lf.Remove(r.Name) {
+				if err = lf.Save(); err != nil {
+					rlog.Fatal().Err(err).Msg("failed to update lock file")
+				}
+			}
+			for _, d := range dirs {
+				if err = os.RemoveAll(d); err != nil {
+					rlog.Fatal().Err(err).Str("path", d).Msg("failed to remove directory")
+				}
+				rlog.Info().Str("path", d).Msg("directory was removed")
+			}
+		}
+	},
+}
+
+func init() {
+	CmdDelete.Flags().BoolVar(&keepSource, "keep-source", false, "Keep package directory with the chart, values and manifests")
+	CmdDelete.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would be removed")
+}
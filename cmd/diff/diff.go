@@ -0,0 +1,163 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/lwolf/kube-atlas/pkg/fileutil"
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/render"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var (
+	parallel int
+)
+
+var diffUsage = `Diff command renders releases into the temporary directory
+and compares the result with the content of the release directory.
+
+Resources are compared by apiVersion, kind, namespace and name,
+formatting and comments are ignored. Command exits with non-zero
+status if any of the releases has drifted, e.g. to check in CI that
+releases were re-rendered after changing values:
+
+	# compare all the releases
+	kube-atlas diff
+
+	# compare specific releases
+	kube-atlas diff prometheus grafana
+`
+
+// CmdDiff represents the diff command
+var CmdDiff = &cobra.Command{
+	Use:     "diff [name...]",
+	Example: "\tkube-atlas diff\n\tkube-atlas diff prometheus",
+	Short:   "Show difference between fresh render and the release directory",
+	Long:    diffUsage,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		releases := s.Releases
+		if len(args) > 0 {
+			releases = nil
+			for _, name := range args {
+				rl := s.ReleaseByName(name)
+				if rl == nil {
+					log.Fatal().Str("release", name).Msg("failed to find release by name in the config")
+				}
+				releases = append(releases, *rl)
+			}
+		}
+		drifted, err := diffReleases(releases, s, os.Stdout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to compare releases")
+		}
+		if drifted > 0 {
+			fmt.Printf("%d of %d releases differ from the rendered output\n", drifted, len(releases))
+			os.Exit(1)
+		}
+		log.Info().Int("releases", len(releases)).Msg("releases are up to date")
+	},
+}
+
+// diffReleases renders releases into the temporary release directory, writes
+// changes of every release to w and returns the number of drifted releases
+func diffReleases(releases []state.ReleaseSpec, s *state.ClusterSpec, w io.Writer) (int, error) {
+	tmp, err := ioutil.TempDir("", "kube-atlas-diff-")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := os.RemoveAll(tmp)
+		if err != nil {
+			log.Error().Err(err).Msg("failed remove temp directory")
+		}
+	}()
+	results, err := render.ToDir(releases, s, tmp, parallel)
+	if err != nil {
+		return 0, err
+	}
+	if render.HasFailures(results) {
+		render.PrintSummary(results, os.Stderr)
+		return 0, fmt.Errorf("failed to render releases")
+	}
+	rendered := *s
+	rendered.Defaults.ReleasePath = tmp
+	var drifted int
+	for _, r := range releases {
+		changes, err := diffRelease(&r, s, &rendered)
+		if err != nil {
+			return drifted, fmt.Errorf("failed to compare release %s: %v", r.Name, err)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		drifted++
+		printChanges(&r, changes, w)
+	}
+	return drifted, nil
+}
+
+// diffRelease compares objects of the committed release directory with the rendered one
+func diffRelease(r *state.ReleaseSpec, committed, rendered *state.ClusterSpec) ([]manifest.Change, error) {
+	oldPath, err := r.GetReleasePath(&committed.Defaults)
+	if err != nil {
+		return nil, err
+	}
+	newPath, err := r.GetReleasePath(&rendered.Defaults)
+	if err != nil {
+		return nil, err
+	}
+	var oldObjs []*manifest.Object
+	if fileutil.Exists(oldPath) {
+		if oldObjs, err = manifest.ParseDir(oldPath); err != nil {
+			return nil, err
+		}
+	}
+	newObjs, err := manifest.ParseDir(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Diff(oldObjs, newObjs)
+}
+
+func printChanges(r *state.ReleaseSpec, changes []manifest.Change, w io.Writer) {
+	fmt.Fprintf(w, "release %s:\n", r.Name)
+	for _, c := range changes {
+		switch c.Type {
+		case manifest.Added:
+			fmt.Fprintf(w, "+ %s\n", c.Key)
+		case manifest.Removed:
+			fmt.Fprintf(w, "- %s\n", c.Key)
+		case manifest.Changed:
+			fmt.Fprintf(w, "~ %s\n%s", c.Key, c.Diff)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func init() {
+	CmdDiff.Flags().IntVar(&parallel, "parallel", 1, "Number of releases rendered concurrently")
+}
@@ -15,15 +15,19 @@
 package fetch
 
 import (
-	"io/ioutil"
+	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
-	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/chartutil"
+	"github.com/lwolf/kube-atlas/pkg/fetch"
+	"github.com/lwolf/kube-atlas/pkg/lock"
 	"github.com/lwolf/kube-atlas/pkg/state"
 )
 
@@ -32,6 +36,8 @@ var (
 	chartVersion string
 	fetchAll     bool
 	devel        bool
+	verify       bool
+	force        bool
 )
 
 var fetchUsage = `fetch command fetches helm chart and stores it 
@@ -50,6 +56,38 @@ Examples:
 	# create a new directory structure 
 	kube-atlas fetch prometheus --chart stable/prometheus --version 8.12.2
 
+Charts from the repositories defined in the config are downloaded directly
+using index of the repository (cached in the user cache directory), charts
+from other repositories are fetched by helm and require "helm repo add".
+Local charts (source: local or chart referenced by the path, e.g.
+./charts/app) are never fetched.
+
+Releases with the git source (url, ref and path inside of the repository)
+are vendored from the git repository, resolved commit is recorded in the
+lock file. Charts referenced as oci://registry/path/chart are pulled from the OCI
+registry, credentials are taken from the repository which url is the prefix
+of the reference.
+
+Dependencies declared by the chart (requirements.yaml or Chart.yaml) which
+are not present in the chart/charts directory are vendored using "helm
+dependency build", or "helm dependency update" if chart has no lock file.
+
+Chart is not downloaded again if the version vendored in the chart directory
+matches the version from the config and the lock file records the same source
+(repository and chart, OCI reference or git url, ref and path) as the config,
+use --force to fetch it anyway. Release missing from the lock file is always
+fetched.
+
+Every fetched chart is recorded in the kube-atlas.lock file next to the
+config: chart name, version, repository URL, sha256 of the chart archive,
+vendored dependencies and hash of the vendored chart directory. Use --verify to make sure that
+vendored charts weren't modified by hand, e.g. in CI:
+
+	# verify all releases (or just one by passing its name)
+	kube-atlas fetch --verify
+
+Modified chart fails verification unless the release is marked as dirty,
+in which case it is only reported.
 `
 
 // upgradeCmd represents the upgrade command
@@ -66,6 +104,24 @@ var CmdFetch = &cobra.Command{
 			log.Fatal().Err(err).Msg("unable to unmarshal config")
 			return
 		}
+		if verify {
+			releases := s.Releases
+			if len(args) > 0 {
+				rl := s.ReleaseByName(args[0])
+				if rl == nil {
+					log.Fatal().Msg("failed to find release by name in the config")
+				}
+				releases = []state.ReleaseSpec{*rl}
+			}
+			lf, err := lock.Load(lock.PathFor(viper.ConfigFileUsed()))
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load lock file")
+			}
+			if err = fetch.Verify(releases, &s, lf); err != nil {
+				log.Fatal().Err(err).Msg("vendored charts don't match the lock file")
+			}
+			return
+		}
 		var releases []state.ReleaseSpec
 		if fetchAll {
 			for _, r := range s.Releases {
@@ -85,15 +141,19 @@ var CmdFetch = &cobra.Command{
 				log.Fatal().Msg("release is marked as dirty in the config, remove the flag first")
 				return
 			}
+			if rl.SourceType() == state.SourceTypeLocal && chartName == "" {
+				log.Fatal().Msg("release uses local chart, it's never fetched")
+				return
+			}
 			log.Debug().Msgf("release information from the config %v", rl)
-			if chartName != "" && rl.Chart != "" && rl.Chart != chartName {
+			if chartName != "" && rl.Chart != chartName {
 				log.Debug().
 					Str("current_chart", rl.Chart).
 					Str("new_chart", chartName).
 					Msg("going to download different chart, please update the config on success")
 				rl.Chart = chartName
 			}
-			if chartVersion != "" && rl.Version != "" && rl.Version != chartVersion {
+			if chartVersion != "" && rl.Version != chartVersion {
 				log.Debug().
 					Str("current_version", rl.Version).
 					Str("new_version", chartVersion).
@@ -104,60 +164,100 @@ var CmdFetch = &cobra.Command{
 		} else {
 			log.Fatal().Msg("either --all or release name is required")
 		}
+		lockPath := lock.PathFor(viper.ConfigFileUsed())
+		lf, err := lock.Load(lockPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load lock file")
+		}
+		var results []fetchResult
 		for _, release := range releases {
-			chartPath, err := release.GetChartPath(&s.Defaults)
-			if err != nil {
-				log.Fatal().Err(err).Msg("failed to construct chart directory for package")
-			}
-
-			// make sure that directory structure exists
-			err = release.InitDirs(&s.Defaults)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to populate directories for package")
-			}
-			fetchFlags := []string{}
-			if chartVersion != "" {
-				fetchFlags = append(fetchFlags, "--version", release.Version)
-			}
-			if release.Devel {
-				fetchFlags = append(fetchFlags, "--devel")
-			}
-			log.Debug().Msgf("going to fetch chart from %s", release.Chart)
-			destTmp, err := ioutil.TempDir("", "helm-")
-			if err != nil {
-				log.Error().Err(err).Msg("failed create temp directory")
+			rlog := log.With().Str("release", release.Name).Logger()
+			res := fetchResult{Name: release.Name}
+			switch release.SourceType() {
+			case state.SourceTypeNone:
+				res.Status, res.Message = statusSkipped, "no chart source"
+				results = append(results, res)
+				continue
+			case state.SourceTypeLocal:
+				res.Status, res.Message = statusSkipped, "local chart is never fetched"
+				results = append(results, res)
+				continue
 			}
-			defer os.RemoveAll(destTmp)
-
-			helm := exec_helm.NewExecHelm(&log.Logger)
-			fetchFlags = append(fetchFlags, "--untar", "--untardir", destTmp)
-			log.Info().Strs("fetchFlags", fetchFlags).Msg("fetch flags:")
-			if err := helm.Fetch(release.Chart, fetchFlags...); err != nil {
-				log.Fatal().Err(err).Msg("failed to fetch chart")
+			if vendored := fetch.VendoredVersion(&release, &s); vendored != "" {
+				res.From = vendored
+				if !force && fetch.SameSource(lf.Get(release.Name), &release, &s) && chartutil.VersionsEqual(vendored, release.Version) {
+					rlog.Info().Str("version", vendored).Msg("vendored chart is up to date, skipping")
+					res.Status, res.To = statusSkipped, vendored
+					results = append(results, res)
+					continue
+				}
 			}
-			files, err := ioutil.ReadDir(destTmp)
+			entry, err := fetch.Release(&release, &s)
 			if err != nil {
-				log.Fatal().Err(err).Msg("failed to read tmp directory with the chart")
+				rlog.Error().Err(err).Msg("failed to fetch chart")
+				res.Status, res.Err = statusFailed, err
+				results = append(results, res)
+				continue
 			}
-			if len(files) != 1 {
-				log.Fatal().Msg("failed to find chart directory after fetching...panic?!")
-			}
-			chartTmp := filepath.Join(destTmp, files[0].Name())
-
-			if err := os.RemoveAll(chartPath); err != nil {
-				log.Error().Err(err).Msg("failed to remove files before update")
+			res.Status, res.To = statusUpdated, entry.Version
+			results = append(results, res)
+			lf.Set(*entry)
+			if err = lf.Save(); err != nil {
+				log.Fatal().Err(err).Str("lock", lockPath).Msg("failed to update lock file")
 			}
-			log.Debug().Str("src", chartTmp).Str("dest", chartPath).Msg("moving chart to destination")
-			if err := os.Rename(chartTmp, chartPath); err != nil {
-				log.Error().Err(err).Msg("failed to move chart")
+		}
+		printSummary(results, os.Stdout)
+		for _, res := range results {
+			if res.Status == statusFailed {
+				os.Exit(1)
 			}
 		}
 	},
 }
 
+const (
+	statusUpdated = "updated"
+	statusSkipped = "skipped"
+	statusFailed  = "failed"
+)
+
+// fetchResult describes outcome of fetching a single release
+type fetchResult struct {
+	Name   string
+	Status string
+	From   string
+	To     string
+	Err    error
+	// Message explains why release was skipped
+	Message string
+}
+
+// printSummary writes table with the outcome of every release
+func printSummary(results []fetchResult, w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELEASE\tSTATUS\tVENDORED\tFETCHED\tMESSAGE")
+	for _, res := range results {
+		msg := res.Message
+		if res.Err != nil {
+			msg = strings.SplitN(res.Err.Error(), "\n", 2)[0]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Name, res.Status, orDash(res.From), orDash(res.To), msg)
+	}
+	_ = tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 func init() {
 	CmdFetch.Flags().StringVar(&chartName, "chart", "", "Name of the helm chart to fetch into package, e.g. stable/prometheus")
 	CmdFetch.Flags().StringVar(&chartVersion, "version", "", "Version of the helm chart to fetch into package, e.g. 8.11.4")
 	CmdFetch.Flags().BoolVar(&fetchAll, "all", false, "Fetch all releases listed in the config")
 	CmdFetch.Flags().BoolVar(&devel, "devel", false, "Fetch development versions of the chart")
+	CmdFetch.Flags().BoolVar(&force, "force", false, "Fetch charts even if vendored version matches the config")
+	CmdFetch.Flags().BoolVar(&verify, "verify", false, "Verify that vendored charts match the lock file instead of fetching")
 }
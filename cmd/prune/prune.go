@@ -0,0 +1,60 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prune
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/lwolf/kube-atlas/pkg/render"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var (
+	dryRun bool
+)
+
+var pruneUsage = `Prune command removes directories from the release path
+which don't belong to any release from the config anymore, e.g. after
+release was removed or its namespace or cluster name has changed.
+
+	# list orphaned directories
+	kube-atlas prune --dry-run
+
+	# remove orphaned directories
+	kube-atlas prune
+`
+
+// CmdPrune represents the prune command
+var CmdPrune = &cobra.Command{
+	Use:     "prune",
+	Example: "\tkube-atlas prune --dry-run",
+	Short:   "Remove orphaned release directories",
+	Long:    pruneUsage,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		if err = render.Prune(s, dryRun); err != nil {
+			log.Fatal().Err(err).Msg("failed to prune release directories")
+		}
+	},
+}
+
+func init() {
+	CmdPrune.Flags().BoolVar(&dryRun, "dry-run", false, "Only list orphaned directories without removing them")
+}
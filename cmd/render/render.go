@@ -15,369 +15,27 @@
 package render
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"path"
-	"path/filepath"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
-	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
-	exec_kustomize "github.com/lwolf/kube-atlas/pkg/exec/kustomize"
-	"github.com/lwolf/kube-atlas/pkg/fileutil"
+	"github.com/lwolf/kube-atlas/pkg/render"
 	"github.com/lwolf/kube-atlas/pkg/state"
 )
 
 var (
 	renderAll bool
 	dryRun    bool
+	force     bool
+	parallel  int
+	prune     bool
 )
 
-type releaseType string
-
-const (
-	releaseTypeHelm      releaseType = "helm"
-	releaseTypeKustomize releaseType = "kustomize"
-	releaseTypeRaw       releaseType = "raw"
-	releaseTypeNone      releaseType = "none"
-)
-
-func releaseContentType(release *state.ReleaseSpec, s *state.ClusterSpec) releaseType {
-	rlog := log.With().Str("release", release.Name).Logger()
-	chartPath, err := release.GetChartPath(&s.Defaults)
-	if err != nil {
-		rlog.Error().Err(err).Msg("failed to get chart directory")
-		return releaseTypeNone
-	}
-	var fls []os.FileInfo
-	fls, err = ioutil.ReadDir(chartPath)
-	if err != nil {
-		rlog.Error().Err(err).Msg("failed to get chart directory content")
-		return releaseTypeNone
-	}
-	if len(fls) == 0 {
-		return releaseTypeNone
-	}
-	var yamlsFound bool
-	for _, f := range fls {
-		if f.Name() == "Chart.yaml" {
-			return releaseTypeHelm
-		} else if f.Name() == "kustomization.yaml" {
-			return releaseTypeKustomize
-		} else if filepath.Ext(f.Name()) == ".yaml" {
-			yamlsFound = true
-		}
-	}
-	if yamlsFound {
-		return releaseTypeRaw
-	}
-	return releaseTypeNone
-}
-
-func renderHelmChart(release *state.ReleaseSpec, s *state.ClusterSpec) error {
-	rlog := log.With().Str("release", release.Name).Logger()
-	renderTmp, err := ioutil.TempDir("", "helm-release-")
-	if err != nil {
-		rlog.Fatal().Err(err).Msg("failed to create temp directory")
-	}
-	defer func() {
-		err := os.RemoveAll(renderTmp)
-		if err != nil {
-			rlog.Error().Err(err).Msg("failed remove temp directory")
-		}
-	}()
-
-	helm := exec_helm.NewExecHelm(&log.Logger)
-	args := []string{
-		"--output-dir", renderTmp,
-		"--name", release.Name,
-		"--kube-version", release.GetKubeVersion(&s.Defaults),
-	}
-	if release.Namespace != "" {
-		args = append(args, "--namespace", release.Namespace)
-	}
-	configPath, err := release.GetValuesPath(&s.Defaults)
-	if err != nil {
-		rlog.Error().Err(err).Msg("failed to get values directory")
-	}
-	for _, configFile := range release.Values {
-		fullPath := filepath.Join(configPath, configFile)
-		isDir, err := fileutil.IsDir(fullPath)
-		if err != nil {
-			rlog.Error().Err(err).Msg("failed to check path")
-			continue
-		}
-		if isDir {
-			rlog.Error().Err(err).Msg("only files are supported at the moment, skipping the directory")
-			continue
-		}
-		if fileutil.Exists(fullPath) {
-			args = append(args, "--values", fullPath)
-		} else {
-			rlog.Error().Str("file", configFile).Msg("values file does not exists, skipping")
-		}
-	}
-	chartPath, err := release.GetChartPath(&s.Defaults)
-	if err != nil {
-		rlog.Error().Err(err).Msg("failed to get chart directory")
-		return err
-	}
-	if err := helm.TemplateRelease(chartPath, args...); err != nil {
-		return err
-	}
-	dstPath, err := release.GetReleasePath(&s.Defaults)
-	if err != nil {
-		return err
-	}
-	err = os.MkdirAll(dstPath, 0755)
-	if err != nil {
-		return err
-	}
-	rlog.Debug().Str("path", dstPath).Msg("destination path for the rendered chart")
-	err = os.RemoveAll(dstPath)
-	if err != nil {
-		rlog.Fatal().Err(err)
-	}
-	err = os.MkdirAll(dstPath, 0755)
-	if err != nil {
-		rlog.Fatal().Err(err)
-	}
-	var fds []os.FileInfo
-	// there should be only a single directory after helm template in the temp
-
-	// resultDir := filepath.Join(destTmp, r.Name)
-	if fds, err = ioutil.ReadDir(renderTmp); err != nil {
-		rlog.Fatal().Err(err).Msg("failed to read directory content")
-	}
-	chartTmpPath := filepath.Join(renderTmp, fds[0].Name())
-	if fds, err = ioutil.ReadDir(chartTmpPath); err != nil {
-		rlog.Fatal().Err(err).Msg("failed to read directory content")
-	}
-	renderMode := release.GetRenderMode(&s.Defaults)
-	switch renderMode {
-	case state.RenderModeSingle:
-		var resultYaml bytes.Buffer
-		for _, fd := range fds {
-			err = concatYamls(filepath.Join(chartTmpPath, fd.Name()), &resultYaml, "")
-		}
-		chartFile := filepath.Join(dstPath, fmt.Sprintf("%s.%s", release.Name, "yaml"))
-		rlog.Debug().Str("chartFile", chartFile).Msg("chart file result")
-		in, err := os.Create(chartFile)
-		if err != nil {
-			rlog.Fatal().Err(err).Msg("failed to create destination yaml for chart")
-		}
-		defer in.Close()
-		_, err = in.Write(resultYaml.Bytes())
-		if err != nil {
-			rlog.Fatal().Err(err).Msg("failed to write concatenated yaml of chart")
-		}
-	case state.RenderModeMulti:
-		for _, fd := range fds {
-			srcfp := filepath.Join(chartTmpPath, fd.Name())
-			dstfp := filepath.Join(dstPath, fd.Name())
-			rlog.Debug().Msgf("copy from %s to %s", srcfp, dstfp)
-			if fd.IsDir() {
-				err = fileutil.CopyDir(srcfp, dstfp, "")
-				if err != nil {
-					rlog.Error().Err(err).Msg("error copying dir")
-				}
-			} else {
-				err = fileutil.CopyFile(srcfp, dstfp)
-				if err != nil {
-					rlog.Error().Err(err).Msg("error copying file")
-				}
-			}
-		}
-	default:
-		rlog.Error().Str("renderMode", renderMode).Msg("Not Implemented Error")
-	}
-	return nil
-}
-
-func concatYamls(src string, buf *bytes.Buffer, separator string) error {
-	var fi os.FileInfo
-	var err error
-	if fi, err = os.Stat(src); err != nil {
-		return err
-	}
-	if fi.IsDir() {
-		var fds []os.FileInfo
-		if fds, err = ioutil.ReadDir(src); err != nil {
-			return err
-		}
-		for _, fd := range fds {
-			err = concatYamls(path.Join(src, fd.Name()), buf, separator)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		var srcfd *os.File
-		if srcfd, err = os.Open(src); err != nil {
-			return err
-		}
-		defer srcfd.Close()
-		if _, err = io.Copy(buf, srcfd); err != nil {
-			return err
-		}
-		// XXX: is there a better way to write new line
-		if _, err = fmt.Fprintln(buf, separator); err != nil {
-			return err
-		}
-	}
-	return err
-}
-
-func renderKustomize(release *state.ReleaseSpec, s *state.ClusterSpec) error {
-	rlog := log.With().Str("release", release.Name).Logger()
-	renderTmp, err := ioutil.TempDir("", "kustomize-release-")
-	if err != nil {
-		rlog.Fatal().Err(err).Msg("failed to create temp directory")
-	}
-	defer func() {
-		err := os.RemoveAll(renderTmp)
-		if err != nil {
-			rlog.Error().Err(err).Msg("failed remove temp directory")
-		}
-	}()
-	exec := exec_kustomize.NewExecKustomize(&log.Logger)
-	chartPath, err := release.GetChartPath(&s.Defaults)
-	if err != nil {
-		rlog.Error().Err(err).Msg("failed to get chart directory")
-		return err
-	}
-	renderMode := release.GetRenderMode(&s.Defaults)
-	args := []string{
-		"--output", renderTmp,
-	}
-	if err := exec.Build(chartPath, args...); err != nil {
-		return err
-	}
-	dstPath, err := release.GetReleasePath(&s.Defaults)
-	if err != nil {
-		return err
-	}
-	err = os.MkdirAll(dstPath, 0755)
-	if err != nil {
-		return err
-	}
-	rlog.Debug().Str("path", dstPath).Msg("destination path for the rendered chart")
-	err = os.RemoveAll(dstPath)
-	if err != nil {
-		rlog.Fatal().Err(err)
-	}
-	err = os.MkdirAll(dstPath, 0755)
-	if err != nil {
-		rlog.Fatal().Err(err)
-	}
-	var fds []os.FileInfo
-	if fds, err = ioutil.ReadDir(renderTmp); err != nil {
-		rlog.Fatal().Err(err).Msg("failed to read directory content")
-	}
-
-	switch renderMode {
-	case state.RenderModeSingle:
-		var resultYaml bytes.Buffer
-		for _, fd := range fds {
-			err = concatYamls(filepath.Join(renderTmp, fd.Name()), &resultYaml, "---")
-		}
-		chartFile := filepath.Join(dstPath, fmt.Sprintf("%s.%s", release.Name, "yaml"))
-		rlog.Debug().Str("chartFile", chartFile).Msg("chart file result")
-		in, err := os.Create(chartFile)
-		if err != nil {
-			rlog.Fatal().Err(err).Msg("failed to create destination yaml for chart")
-		}
-		defer in.Close()
-		_, err = in.Write(resultYaml.Bytes())
-		if err != nil {
-			rlog.Fatal().Err(err).Msg("failed to write concatenated yaml of chart")
-		}
-	case state.RenderModeMulti:
-		for _, fd := range fds {
-			srcfp := filepath.Join(renderTmp, fd.Name())
-			dstfp := filepath.Join(dstPath, fd.Name())
-			rlog.Debug().Msgf("copy from %s to %s", srcfp, dstfp)
-			if fd.IsDir() {
-				err = fileutil.CopyDir(srcfp, dstfp, "")
-				if err != nil {
-					rlog.Error().Err(err).Msg("error copying dir")
-				}
-			} else {
-				err = fileutil.CopyFile(srcfp, dstfp)
-				if err != nil {
-					rlog.Error().Err(err).Msg("error copying file")
-				}
-			}
-		}
-	default:
-		rlog.Error().Str("renderMode", renderMode).Msg("Not Implemented Error")
-	}
-	return nil
-}
-
-func renderRaw(release *state.ReleaseSpec, s *state.ClusterSpec) error {
-	return fmt.Errorf("not implemented error")
-}
-
-func copyManifests(release *state.ReleaseSpec, s *state.ClusterSpec) error {
-	rlog := log.With().Str("release", release.Name).Logger()
-	manifestsPath, err := release.GetManifestsPath(&s.Defaults)
-	if err != nil {
-		return err
-	}
-	dstPath, err := release.GetReleasePath(&s.Defaults)
-	if err != nil {
-		return err
-	}
-	// by default include all the manifests in the folder
-	// any value set in manifests key overrides it
-	manifests := release.Manifests
-	if len(release.Manifests) == 0 {
-		log.Debug().
-			Str("release", release.Name).
-			Msg("no whitelisted manifests found, including all")
-		var fds []os.FileInfo
-		if fds, err = ioutil.ReadDir(manifestsPath); err != nil {
-			return err
-		}
-		for _, f := range fds {
-			log.Debug().Msgf("including `%s`", f.Name())
-			manifests = append(manifests, f.Name())
-		}
-	}
-	for _, m := range manifests {
-		m = filepath.Clean(m)
-		mlog := rlog.With().Str("manifest", m).Logger()
-		p := filepath.Join(manifestsPath, m)
-		if !fileutil.Exists(p) {
-			mlog.Info().Str("path", p).Msg("file does not exist")
-			continue
-		}
-		isDir, err := fileutil.IsDir(p)
-		if err != nil {
-			continue
-		}
-		if isDir {
-			err = fileutil.CopyDir(p, dstPath, m)
-			if err != nil {
-				mlog.Error().Err(err).Msg("failed to copy directory")
-			}
-		} else {
-			manifestDestPath := filepath.Join(dstPath, fmt.Sprintf("manifest-%s", m))
-			rlog.Debug().Str("source", p).Str("dst", manifestDestPath).Msg("going to copy raw manifests")
-			err = fileutil.CopyFile(p, manifestDestPath)
-			if err != nil {
-				mlog.Error().Err(err).Msg("failed to copy")
-			}
-		}
-	}
-	return nil
-}
-
 // renderCmd represents the render command
 var CmdRender = &cobra.Command{
 	Use:   "render",
@@ -386,20 +44,49 @@ var CmdRender = &cobra.Command{
 release and writes the resulting yamls to the corresponding
  directory.
 
-* For helm chart it will do "helm template"
+* For helm chart it will do "helm template", charts with dependencies
+  missing from the charts directory are not rendered
 * For kustomize it will do kustomization
 * For raw yamls it will just copy it to the destination 
 
-After that it will also copy manifests listed in the spec.`,
+Rendered resources are patched using files from the patches directory
+of the package. Every yaml document in the patch file is either a partial
+resource (strategic merge patch of the resource with the same kind and name)
+or an explicit patch with the target selector:
+
+	type: json # json (RFC 6902), merge (RFC 7386) or strategic
+	target:
+	  kind: Deployment
+	  name: prometheus-server
+	patch:
+	  - op: replace
+	    path: /spec/replicas
+	    value: 2
+
+Unless the release is post-rendered by kustomize, strategic merge patches
+are applied without the resource schema: lists of objects are merged by
+the first of mountPath, containerPort, port, name or ip keys present in
+all the items of the patch list, other lists are replaced. Items are removed with "$patch: delete", "$patch: replace"
+replaces the whole object instead of merging it.
+
+For releases post-rendered by kustomize merge (RFC 7386) patches are
+applied before the rest of the patches which are handled by kustomize.
+
+After that it will also copy manifests listed in the spec.
+
+Hash of the release inputs (chart, values, manifests, patches, release
+spec and helm/kustomize versions) is stored in the release directory,
+releases with unchanged inputs are skipped unless --force is set.
+
+Use --dry-run to print the result to stdout instead of writing
+it to the release directory, e.g. to validate it in CI:
+
+	kube-atlas render --all --dry-run | kubeval`,
 	Run: func(cmd *cobra.Command, args []string) {
 		s, err := state.LoadSpec()
 		if err != nil {
 			log.Fatal().Err(err).Msg("unable to unmarshal config")
 		}
-		err = s.CreateReleaseDirectories()
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to create destination directories")
-		}
 		var releases []state.ReleaseSpec
 		if renderAll {
 			releases = s.Releases
@@ -418,61 +105,96 @@ After that it will also copy manifests listed in the spec.`,
 		} else {
 			log.Fatal().Msg("either --all or release name is required")
 		}
+		if dryRun {
+			err = renderDryRun(releases, s, os.Stdout)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to render")
+			}
+			if prune {
+				if err = render.Prune(s, true); err != nil {
+					log.Fatal().Err(err).Msg("failed to list orphaned release directories")
+				}
+			}
+			return
+		}
 		err = s.CreateReleaseDirectories()
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to create target directory structure")
 		}
-		clusterPath := s.Defaults.GetReleasePath()
-		err = os.MkdirAll(clusterPath, 0755)
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to create release directory")
-		}
-		for _, r := range releases {
+		tools := render.ToolVersions()
+		results := render.Parallel(releases, parallel, func(r *state.ReleaseSpec) (render.Status, error) {
 			rlog := log.With().Str("release", r.Name).Logger()
-			// validate that chart directory exists and not empty
-			_, err := r.GetChartPath(&s.Defaults)
+			hash, err := render.ReleaseHash(r, s, tools)
 			if err != nil {
-				rlog.Error().Err(err).Msg("failed to get chart directory")
-				continue
+				rlog.Error().Err(err).Msg("failed to calculate hash of the release inputs")
 			}
-			// process chart directory
-			switch releaseContentType(&r, s) {
-			case releaseTypeHelm:
-				err = renderHelmChart(&r, s)
-				if err != nil {
-					log.Error().Err(err).Msg("failed to render helm chart")
-					break
-				}
-				rlog.Info().Msg("completed rendering helm chart")
-			case releaseTypeKustomize:
-				err = renderKustomize(&r, s)
-				if err != nil {
-					log.Error().Err(err).Msg("failed to apply kustomization")
-					break
-				}
-				rlog.Info().Msg("completed kustomization")
-			case releaseTypeRaw:
-				err = renderRaw(&r, s)
-				if err != nil {
-					log.Error().Err(err).Msg("failed to copy raw manifests")
-					break
+			if !force && hash != "" && render.IsUpToDate(r, s, hash) {
+				rlog.Info().Msg("release is up to date, skipping")
+				return render.StatusSkipped, nil
+			}
+			// hash of the previous render must not outlive partially written release
+			if err = render.RemoveReleaseHash(r, s); err != nil {
+				return render.StatusFailed, err
+			}
+			if err = render.Release(r, s); err != nil {
+				return render.StatusFailed, err
+			}
+			// release is rendered and all the files are copied at this point
+			if hash != "" {
+				if err = render.WriteReleaseHash(r, s, hash); err != nil {
+					rlog.Error().Err(err).Msg("failed to store hash of the release inputs")
 				}
-			case releaseTypeNone:
-			default:
-				rlog.Warn().Msg("unknown release chart folder content, skipping")
 			}
-			// process manifests directory
-			err = copyManifests(&r, s)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to copy manifests")
-				continue
+			return render.StatusSucceeded, nil
+		})
+		render.PrintSummary(results, os.Stdout)
+		if render.HasFailures(results) {
+			os.Exit(1)
+		}
+		if prune {
+			if err = render.Prune(s, false); err != nil {
+				log.Fatal().Err(err).Msg("failed to prune release directories")
 			}
-			rlog.Info().Msg("manifests were copied")
 		}
 	},
 }
 
+// renderDryRun renders releases into the temporary release directory
+// and writes all the resulting files to w
+func renderDryRun(releases []state.ReleaseSpec, s *state.ClusterSpec, w io.Writer) error {
+	tmp, err := ioutil.TempDir("", "kube-atlas-dry-run-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := os.RemoveAll(tmp)
+		if err != nil {
+			log.Error().Err(err).Msg("failed remove temp directory")
+		}
+	}()
+	results, err := render.ToDir(releases, s, tmp, parallel)
+	if err != nil {
+		return err
+	}
+	if err = render.PrintTree(tmp, s.Defaults.GetReleasePath(), w); err != nil {
+		return err
+	}
+	var failed []string
+	for _, res := range results {
+		if res.Status == render.StatusFailed {
+			failed = append(failed, res.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to render releases: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
 func init() {
 	CmdRender.Flags().BoolVar(&renderAll, "all", false, "Render all the releases listed in the config")
-	CmdRender.Flags().BoolVar(&dryRun, "dry-run", false, "Render to stdout")
+	CmdRender.Flags().BoolVar(&dryRun, "dry-run", false, "Render to stdout without touching the release directory")
+	CmdRender.Flags().BoolVar(&prune, "prune", false, "Remove release directories which don't belong to any release after rendering")
+	CmdRender.Flags().IntVar(&parallel, "parallel", 1, "Number of releases rendered concurrently")
+	CmdRender.Flags().BoolVar(&force, "force", false, "Render releases even if their inputs are unchanged since the last render")
 }
@@ -0,0 +1,79 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var (
+	addUsername     string
+	addPassword     string
+	addUsernameEnv  string
+	addPasswordEnv  string
+	addPasswordFile string
+	addCertFile     string
+	addKeyFile      string
+)
+
+var cmdAdd = &cobra.Command{
+	Use:     "add NAME URL",
+	Example: "\tkube-atlas repo add stable https://kubernetes-charts.storage.googleapis.com",
+	Short:   "Add repository to the config and register it in helm",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfgFile, err := configFile()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to add repository")
+		}
+		spec := state.RepositorySpec{
+			Name:         args[0],
+			URL:          args[1],
+			Username:     addUsername,
+			Password:     addPassword,
+			UsernameEnv:  addUsernameEnv,
+			PasswordEnv:  addPasswordEnv,
+			PasswordFile: addPasswordFile,
+			CertFile:     addCertFile,
+			KeyFile:      addKeyFile,
+		}
+		resolved, err := spec.Resolve()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to resolve repository credentials")
+		}
+		if err = state.AddRepository(cfgFile, spec); err != nil {
+			log.Fatal().Err(err).Msg("failed to add repository")
+		}
+		log.Info().Str("repository", spec.Name).Msg("repository was added to the config")
+		helm := exec_helm.NewExecHelm(&log.Logger)
+		if err = helm.AddRepo(resolved.Name, resolved.URL, resolved.CertFile, resolved.KeyFile, resolved.Username, resolved.Password); err != nil {
+			log.Fatal().Err(err).Msg("failed to register repository in helm, run \"kube-atlas repo sync\" to retry")
+		}
+	},
+}
+
+func init() {
+	cmdAdd.Flags().StringVar(&addUsername, "username", "", "Username of the repository")
+	cmdAdd.Flags().StringVar(&addPassword, "password", "", "Password of the repository, stored in the config as is")
+	cmdAdd.Flags().StringVar(&addUsernameEnv, "username-env", "", "Environment variable with the username of the repository")
+	cmdAdd.Flags().StringVar(&addPasswordEnv, "password-env", "", "Environment variable with the password of the repository")
+	cmdAdd.Flags().StringVar(&addPasswordFile, "password-file", "", "File with the password of the repository")
+	cmdAdd.Flags().StringVar(&addCertFile, "cert-file", "", "Client certificate file of the repository")
+	cmdAdd.Flags().StringVar(&addKeyFile, "key-file", "", "Client key file of the repository")
+}
@@ -0,0 +1,47 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var cmdList = &cobra.Command{
+	Use:   "list",
+	Short: "List repositories from the config",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		for _, name := range s.DuplicateRepositories() {
+			log.Warn().Str("repository", name).Msg("repository is defined more than once")
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tURL")
+		for _, r := range s.Repositories {
+			fmt.Fprintf(tw, "%s\t%s\n", r.Name, r.URL)
+		}
+		_ = tw.Flush()
+	},
+}
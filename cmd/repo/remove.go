@@ -0,0 +1,53 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var cmdRemove = &cobra.Command{
+	Use:     "remove NAME",
+	Aliases: []string{"rm"},
+	Short:   "Remove repository from the config and helm",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfgFile, err := configFile()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to remove repository")
+		}
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		for _, r := range s.Releases {
+			if r.RepositoryName() == args[0] {
+				log.Warn().Str("release", r.Name).Msg("release uses the repository being removed")
+			}
+		}
+		if err = state.RemoveRepository(cfgFile, args[0]); err != nil {
+			log.Fatal().Err(err).Msg("failed to remove repository")
+		}
+		log.Info().Str("repository", args[0]).Msg("repository was removed from the config")
+		helm := exec_helm.NewExecHelm(&log.Logger)
+		if err = helm.RemoveRepo(args[0]); err != nil {
+			log.Warn().Err(err).Msg("failed to remove repository from helm")
+		}
+	},
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var repoUsage = `Repo command manages helm chart repositories and versions
+of the charts used by the releases. Repositories are defined in the
+repositories section of the config, add and remove commands edit it.
+
+	# register all the repositories from the config in helm
+	kube-atlas repo sync
+
+	# add repository to the config
+	kube-atlas repo add stable https://kubernetes-charts.storage.googleapis.com
+
+	# download the latest indexes of the repositories
+	kube-atlas repo update
+
+	# list newer versions of the charts
+	kube-atlas repo upgrade --dry-run
+`
+
+// CmdRepo represents the repo command
+var CmdRepo = &cobra.Command{
+	Use:   "repo",
+	Short: "Manage chart repositories and chart versions",
+	Long:  repoUsage,
+}
+
+// configFile returns path of the config file edited by the repo commands
+func configFile() (string, error) {
+	cfgFile := viper.ConfigFileUsed()
+	if cfgFile == "" {
+		return "", fmt.Errorf("config file is required")
+	}
+	return cfgFile, nil
+}
+
+func init() {
+	CmdRepo.AddCommand(cmdList)
+	CmdRepo.AddCommand(cmdAdd)
+	CmdRepo.AddCommand(cmdRemove)
+	CmdRepo.AddCommand(cmdUpdate)
+	CmdRepo.AddCommand(cmdSync)
+	CmdRepo.AddCommand(cmdUpgrade)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var cmdSync = &cobra.Command{
+	Use:   "sync",
+	Short: "Register all the repositories from the config in helm",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		if dups := s.DuplicateRepositories(); len(dups) > 0 {
+			log.Fatal().Strs("repositories", dups).Msg("repositories are defined more than once, remove duplicates from the config")
+		}
+		helm := exec_helm.NewExecHelm(&log.Logger)
+		failed := false
+		for _, r := range s.Repositories {
+			r, err := r.Resolve()
+			if err == nil {
+				err = helm.AddRepo(r.Name, r.URL, r.CertFile, r.KeyFile, r.Username, r.Password)
+			}
+			if err != nil {
+				log.Error().Err(err).Str("repository", r.Name).Msg("failed to register repository")
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,59 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/repo"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var cmdUpdate = &cobra.Command{
+	Use:   "update",
+	Short: "Update cached indexes of the repositories",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		failed := false
+		for _, spec := range s.Repositories {
+			rlog := log.With().Str("repository", spec.Name).Logger()
+			client, err := repo.NewClient(spec, repo.DefaultCacheDir())
+			if err == nil {
+				_, err = client.Index(true)
+			}
+			if err != nil {
+				rlog.Error().Err(err).Msg("failed to update repository index")
+				failed = true
+				continue
+			}
+			rlog.Info().Msg("repository index was updated")
+		}
+		helm := exec_helm.NewExecHelm(&log.Logger)
+		if err = helm.UpdateRepo(); err != nil {
+			log.Warn().Err(err).Msg("failed to update helm repositories")
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,224 @@
+// Copyright © 2019 Sergey Nuzhdin ipaq.lw@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/fetch"
+	"github.com/lwolf/kube-atlas/pkg/lock"
+	"github.com/lwolf/kube-atlas/pkg/repo"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var (
+	upgradeDryRun bool
+)
+
+var upgradeUsage = `Upgrade command looks up repository indexes for chart versions
+newer than the version of the release, updates version in the config and
+fetches the new chart. Indexes of the repositories from the config are
+downloaded, others are read from the helm cache, run "helm repo update"
+first to get the latest ones.
+
+By default release is upgraded to the latest version with the same major,
+set upgradeConstraint of the release to control it, e.g. "~8.11" allows
+only patch upgrades and ">=8.0.0" allows major upgrades.
+
+	# list newer versions of all the charts
+	kube-atlas repo upgrade --dry-run
+
+	# upgrade prometheus chart
+	kube-atlas repo upgrade prometheus
+`
+
+// upgradeResult describes upgrade of a single release
+type upgradeResult struct {
+	Release string
+	Upgrade *repo.Upgrade
+	Err     error
+}
+
+var cmdUpgrade = &cobra.Command{
+	Use:     "upgrade [name...]",
+	Example: "\tkube-atlas repo upgrade --dry-run\n\tkube-atlas repo upgrade prometheus",
+	Short:   "Upgrade charts to the newer versions",
+	Long:    upgradeUsage,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := state.LoadSpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to unmarshal config")
+		}
+		var releases []state.ReleaseSpec
+		if len(args) > 0 {
+			for _, name := range args {
+				rl := s.ReleaseByName(name)
+				if rl == nil {
+					log.Fatal().Str("release", name).Msg("failed to find release by name in the config")
+				}
+				releases = append(releases, *rl)
+			}
+		} else {
+			for _, r := range s.Releases {
+				if r.Chart != "" && r.Version != "" && r.SourceType() == state.SourceTypeRepository {
+					releases = append(releases, r)
+				}
+			}
+		}
+		results := findUpgrades(releases, s)
+		printUpgrades(results, os.Stdout)
+		if upgradeDryRun {
+			return
+		}
+		failed := false
+		for _, res := range results {
+			if res.Err != nil {
+				failed = true
+			}
+		}
+		if err = applyUpgrades(s, results); err != nil {
+			log.Error().Err(err).Msg("failed to upgrade releases")
+			failed = true
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// findUpgrades looks up newer versions for every release in the indexes of the repositories
+func findUpgrades(releases []state.ReleaseSpec, s *state.ClusterSpec) []upgradeResult {
+	indexes := map[string]*repo.IndexFile{}
+	var results []upgradeResult
+	for _, r := range releases {
+		res := upgradeResult{Release: r.Name}
+		results = append(results, res)
+		cur := &results[len(results)-1]
+		repoName := r.RepositoryName()
+		if repoName == "" || r.Version == "" {
+			cur.Err = fmt.Errorf("upgrade is supported only for pinned charts from the helm repositories")
+			continue
+		}
+		index, ok := indexes[repoName]
+		if !ok {
+			index, cur.Err = loadIndex(s, repoName)
+			if cur.Err != nil {
+				continue
+			}
+			indexes[repoName] = index
+		}
+		cur.Upgrade, cur.Err = repo.FindUpgrade(index, r.ChartName(), r.Version, r.UpgradeConstraint, r.Devel)
+	}
+	return results
+}
+
+// loadIndex downloads fresh index of the repository from the config,
+// index of the repository unknown to the config is read from the helm cache
+func loadIndex(s *state.ClusterSpec, name string) (*repo.IndexFile, error) {
+	if spec := s.RepositoryByName(name); spec != nil {
+		client, err := repo.NewClient(*spec, repo.DefaultCacheDir())
+		if err != nil {
+			return nil, err
+		}
+		return client.Index(true)
+	}
+	helmHome, err := exec_helm.NewExecHelm(&log.Logger).Home()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find helm home directory: %v", err)
+	}
+	return repo.LoadIndexFile(repo.HelmCacheIndexPath(helmHome, name))
+}
+
+// printUpgrades writes table of available versions for every release
+func printUpgrades(results []upgradeResult, w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELEASE\tCURRENT\tPATCH\tMINOR\tMAJOR\tTARGET\tAPP VERSION\tERROR")
+	for _, res := range results {
+		if res.Err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t-\t%s\n", res.Release, strings.SplitN(res.Err.Error(), "\n", 2)[0])
+			continue
+		}
+		u := res.Upgrade
+		// missing versions are shown as "-"
+		row := []string{res.Release, u.Current, u.Patch, u.Minor, u.Major, u.Target, u.CurrentAppVersion, u.TargetAppVersion}
+		for i := range row {
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+		app := row[6]
+		if u.Target != "" && u.TargetAppVersion != u.CurrentAppVersion {
+			app = fmt.Sprintf("%s -> %s", app, row[7])
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", row[0], row[1], row[2], row[3], row[4], row[5], app)
+	}
+	_ = tw.Flush()
+}
+
+// applyUpgrades bumps version of the releases in the config and fetches new charts
+func applyUpgrades(s *state.ClusterSpec, results []upgradeResult) error {
+	cfgFile, err := configFile()
+	if err != nil {
+		return err
+	}
+	lockPath := lock.PathFor(cfgFile)
+	lf, err := lock.Load(lockPath)
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, res := range results {
+		if res.Err != nil || res.Upgrade.Target == "" {
+			continue
+		}
+		rlog := log.With().Str("release", res.Release).Logger()
+		release := s.ReleaseByName(res.Release)
+		if release.Dirty {
+			rlog.Warn().Msg("release is marked as dirty, skipping")
+			continue
+		}
+		release.Version = res.Upgrade.Target
+		entry, err := fetch.Release(release, s)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed to fetch chart")
+			failed = append(failed, res.Release)
+			continue
+		}
+		lf.Set(*entry)
+		if err = lf.Save(); err != nil {
+			return err
+		}
+		if err = state.SetReleaseVersion(cfgFile, release.Name, release.Version); err != nil {
+			return err
+		}
+		rlog.Info().Str("from", res.Upgrade.Current).Str("to", release.Version).Msg("release was upgraded")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to upgrade releases: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func init() {
+	cmdUpgrade.Flags().BoolVar(&upgradeDryRun, "dry-run", false, "Only list newer versions without changing anything")
+}
@@ -25,8 +25,12 @@ import (
 
 	"github.com/lwolf/kube-atlas/cmd/add"
 	"github.com/lwolf/kube-atlas/cmd/bootstrap"
+	"github.com/lwolf/kube-atlas/cmd/delete"
+	"github.com/lwolf/kube-atlas/cmd/diff"
 	"github.com/lwolf/kube-atlas/cmd/fetch"
+	"github.com/lwolf/kube-atlas/cmd/prune"
 	"github.com/lwolf/kube-atlas/cmd/render"
+	"github.com/lwolf/kube-atlas/cmd/repo"
 )
 
 var globalUsage = `kube-atlas is an opinionated way to manage Kubernetes manifests
@@ -41,8 +45,12 @@ This will create a kube-atlas.yaml file in your current directory..
 Common actions from this point include:
 
 - kube-atlas add:        add entry to your cluster state, will create required directories
+- kube-atlas delete:     remove release from the config together with its directories
 - kube-atlas fetch:      download new version of chart to your local directory 
-- kube-atlas render:     render entire cluster state to the release directory `
+- kube-atlas render:     render entire cluster state to the release directory
+- kube-atlas diff:       compare fresh render with the release directory
+- kube-atlas prune:      remove release directories not present in the config
+- kube-atlas repo:       manage chart repositories and upgrade charts `
 
 var (
 	cfgFile     string
@@ -87,8 +95,12 @@ func init() {
 	RootCmd.Version = Version
 	RootCmd.AddCommand(fetch.CmdFetch)
 	RootCmd.AddCommand(add.CmdAdd)
+	RootCmd.AddCommand(delete.CmdDelete)
 	RootCmd.AddCommand(render.CmdRender)
 	RootCmd.AddCommand(bootstrap.CmdInit)
+	RootCmd.AddCommand(diff.CmdDiff)
+	RootCmd.AddCommand(prune.CmdPrune)
+	RootCmd.AddCommand(repo.CmdRepo)
 }
 
 func validateDependencies() {
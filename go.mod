@@ -3,12 +3,16 @@ module github.com/lwolf/kube-atlas
 go 1.12
 
 require (
+	github.com/Masterminds/semver v1.5.0
 	github.com/alecthomas/units v0.0.0-20190717042225-c3de453c63f4 // indirect
 	github.com/cyphar/filepath-securejoin v0.2.2
+	github.com/evanphx/json-patch v4.5.0+incompatible
+	github.com/ghodss/yaml v1.0.0
 	github.com/google/go-cmp v0.2.0
 	github.com/magiconair/properties v1.8.1 // indirect
 	github.com/manifoldco/promptui v0.3.2
 	github.com/pelletier/go-toml v1.4.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/rs/zerolog v1.14.3
 	github.com/spf13/afero v1.2.2 // indirect
 	github.com/spf13/cobra v0.0.4
@@ -18,4 +22,5 @@ require (
 	golang.org/x/sys v0.0.0-20190602015325-4c4f7f33c9ed // indirect
 	golang.org/x/text v0.3.2 // indirect
 	gopkg.in/alecthomas/kingpin.v3-unstable v3.0.0-20180810215634-df19058c872c // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1 +1,265 @@
 package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+const (
+	// DefaultConfigFile is the name of the config file created in the project root
+	DefaultConfigFile = "kube-atlas.yaml"
+	// GitignoreName is the name of the .gitignore file created in the project root
+	GitignoreName = ".gitignore"
+)
+
+// gitignoreEntries are temporary artifacts which shouldn't be committed
+var gitignoreEntries = []string{
+	"# backups of the chart dependencies made by helm dependency update",
+	"tmpcharts/",
+	"# chart archives downloaded by hand",
+	"/*.tgz",
+	"# editor and OS files",
+	"*.swp",
+	"*~",
+	".DS_Store",
+	".idea/",
+}
+
+var configTemplate = template.Must(template.New("config").Funcs(template.FuncMap{"yaml": yamlScalar}).Parse(
+	`# kube-atlas configuration, see examples/kube-atlas.yaml of the kube-atlas
+# repository for the full list of options
+
+# helm chart repositories, use "kube-atlas repo add" to add new one. Credentials
+# could be taken from environment (usernameEnv, passwordEnv) or file (passwordFile)
+repositories: []
+
+defaults:
+  # name of the cluster, part of the release path
+  clusterName: {{ yaml .ClusterName }}
+  # directory with packages (chart, values, manifests and patches) of the releases
+  sourcePath: {{ yaml .SourcePath }}
+  # directory with the rendered releases
+  releasePath: {{ yaml .ReleasePath }}
+  # kubernetes version used to render charts
+  kubeVersion: {{ yaml .KubeVersion }}
+  # single, multi, ordered or custom
+  renderMode: {{ yaml .RenderMode }}
+
+# use "kube-atlas add <name> --chart repo/chart" to add new release
+releases: []
+`))
+
+// Options describe the new project
+type Options struct {
+	// Dir is the root of the project, all the paths are relative to it
+	Dir string
+	// ConfigFile is the path of the config file, relative to the Dir unless absolute
+	ConfigFile string
+	// Force allows to overwrite existing config file
+	Force    bool
+	Defaults state.DefaultConfig
+	// Repositories and Releases are added to the config, e.g. imported from helm
+	Repositories []state.RepositorySpec
+	Releases     []state.ReleaseSpec
+}
+
+// Execute writes config file, creates source and release directories (and
+// package directories of the releases) and adds temporary artifacts to the
+// .gitignore of the project. Returns paths of the created or updated files
+// and directories
+func Execute(o Options) ([]string, error) {
+	if o.Dir == "" {
+		o.Dir = "."
+	}
+	if o.ConfigFile == "" {
+		o.ConfigFile = DefaultConfigFile
+	}
+	d := o.Defaults
+	if d.ClusterName == "" {
+		return nil, fmt.Errorf("cluster name is required")
+	}
+	if d.SourcePath == "" {
+		d.SourcePath = state.DefaultSourceDir
+	}
+	if d.ReleasePath == "" {
+		d.ReleasePath = state.DefaultReleaseDir
+	}
+	if d.KubeVersion == "" {
+		d.KubeVersion = state.DefaultKubeVersion
+	}
+	if d.RenderMode == "" {
+		d.RenderMode = state.DefaultRenderMode
+	}
+	configPath := o.configPath()
+	if _, err := os.Stat(configPath); err == nil && !o.Force {
+		return nil, fmt.Errorf("config %s already exists, use --force to overwrite it", configPath)
+	}
+	if err := validateEntries(o.Repositories, o.Releases); err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, p := range []string{d.SourcePath, filepath.Join(d.ReleasePath, d.ClusterName)} {
+		dir := filepath.Join(o.Dir, p)
+		if _, err := os.Stat(dir); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return created, err
+		}
+		created = append(created, dir)
+	}
+	var buf bytes.Buffer
+	if err := configTemplate.Execute(&buf, d); err != nil {
+		return created, err
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return created, err
+	}
+	if err := ioutil.WriteFile(configPath, buf.Bytes(), 0644); err != nil {
+		return created, err
+	}
+	created = append(created, configPath)
+	if len(o.Repositories) > 0 || len(o.Releases) > 0 {
+		if err := addEntries(configPath, o.Repositories, o.Releases); err != nil {
+			return created, err
+		}
+	}
+	// package directories are relative to the project root
+	pd := d
+	pd.SourcePath = filepath.Join(o.Dir, d.SourcePath)
+	for i := range o.Releases {
+		r := &o.Releases[i]
+		pkgPath, err := r.GetPkgPath(&pd)
+		if err != nil {
+			return created, err
+		}
+		_, statErr := os.Stat(pkgPath)
+		if err = r.InitDirs(&pd); err != nil {
+			return created, err
+		}
+		if os.IsNotExist(statErr) {
+			created = append(created, pkgPath)
+		}
+	}
+
+	gitignore := filepath.Join(o.Dir, GitignoreName)
+	updated, err := updateGitignore(gitignore)
+	if err != nil {
+		return created, err
+	}
+	if updated {
+		created = append(created, gitignore)
+	}
+	return created, nil
+}
+
+// configPath returns location of the config file, relative path
+// of the config is relative to the project root
+func (o Options) configPath() string {
+	configFile := o.ConfigFile
+	if configFile == "" {
+		configFile = DefaultConfigFile
+	}
+	if filepath.IsAbs(configFile) {
+		return configFile
+	}
+	return filepath.Join(o.Dir, configFile)
+}
+
+// validateEntries makes sure that repositories and releases could be added
+// to the config, before anything is written to the disk
+func validateEntries(repos []state.RepositorySpec, releases []state.ReleaseSpec) error {
+	seen := make(map[string]bool)
+	for _, r := range repos {
+		if r.Name == "" {
+			return fmt.Errorf("repository %s has no name", r.URL)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("repository %s is listed more than once", r.Name)
+		}
+		seen[r.Name] = true
+	}
+	seen = make(map[string]bool)
+	for _, r := range releases {
+		if r.Name == "" {
+			return fmt.Errorf("release of the chart %s has no name", r.Chart)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("release %s is listed more than once", r.Name)
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+// addEntries writes repositories and releases to the config
+func addEntries(configPath string, repos []state.RepositorySpec, releases []state.ReleaseSpec) error {
+	e, err := state.LoadConfigEditor(configPath)
+	if err != nil {
+		return err
+	}
+	for _, r := range repos {
+		if err = e.AddRepository(r); err != nil {
+			return err
+		}
+	}
+	for _, r := range releases {
+		if err = e.AddRelease(r); err != nil {
+			return err
+		}
+	}
+	return e.Save()
+}
+
+// updateGitignore appends entries missing from the .gitignore,
+// returns true if the file was changed
+func updateGitignore(path string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	present := map[string]bool{}
+	for _, l := range strings.Split(string(data), "\n") {
+		present[strings.TrimSpace(l)] = true
+	}
+	var missing []string
+	for _, e := range gitignoreEntries {
+		if !strings.HasPrefix(e, "#") && !present[e] {
+			missing = append(missing, e)
+		}
+	}
+	if len(missing) == 0 {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	buf.Write(data)
+	if len(data) > 0 {
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n# kube-atlas\n")
+		buf.WriteString(strings.Join(missing, "\n") + "\n")
+	} else {
+		buf.WriteString(strings.Join(gitignoreEntries, "\n") + "\n")
+	}
+	return true, ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// yamlScalar formats string as a yaml scalar, quoting it when required
+func yamlScalar(s string) (string, error) {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
@@ -0,0 +1,169 @@
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+func TestExecute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-bootstrap")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, GitignoreName), []byte("/bin\n*.swp"), 0644); err != nil {
+		t.Fatalf("failed to write .gitignore %v", err)
+	}
+	o := Options{
+		Dir:      dir,
+		Defaults: state.DefaultConfig{ClusterName: "dev: east", SourcePath: "src", ReleasePath: "out"},
+	}
+	created, err := Execute(o)
+	if err != nil {
+		t.Fatalf("failed to initialize project %v", err)
+	}
+	exp := []string{
+		filepath.Join(dir, "src"),
+		filepath.Join(dir, "out", "dev: east"),
+		filepath.Join(dir, DefaultConfigFile),
+		filepath.Join(dir, GitignoreName),
+	}
+	if diff := cmp.Diff(exp, created); diff != "" {
+		t.Fatalf("unexpected created paths (-want +got):\n%s", diff)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, DefaultConfigFile))
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	var cs state.ClusterSpec
+	if err = yaml.Unmarshal(data, &cs); err != nil {
+		t.Fatalf("failed to parse config %v", err)
+	}
+	expDefaults := state.DefaultConfig{
+		ClusterName: "dev: east",
+		SourcePath:  "src",
+		ReleasePath: "out",
+		KubeVersion: state.DefaultKubeVersion,
+		RenderMode:  state.DefaultRenderMode,
+	}
+	if diff := cmp.Diff(expDefaults, cs.Defaults); diff != "" {
+		t.Fatalf("unexpected defaults (-want +got):\n%s", diff)
+	}
+	gitignore, err := ioutil.ReadFile(filepath.Join(dir, GitignoreName))
+	if err != nil {
+		t.Fatalf("failed to read .gitignore %v", err)
+	}
+	if !strings.HasPrefix(string(gitignore), "/bin\n*.swp\n\n# kube-atlas\ntmpcharts/\n") || strings.Count(string(gitignore), "*.swp") != 1 {
+		t.Fatalf("unexpected content of .gitignore %q", gitignore)
+	}
+
+	// existing config is kept without --force
+	if _, err = Execute(o); err == nil {
+		t.Fatalf("expected error for existing config")
+	}
+	o.Force = true
+	if created, err = Execute(o); err != nil {
+		t.Fatalf("failed to overwrite config %v", err)
+	}
+	if diff := cmp.Diff([]string{filepath.Join(dir, DefaultConfigFile)}, created); diff != "" {
+		t.Fatalf("unexpected created paths (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecuteAbsoluteConfigPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-bootstrap")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config", "cluster.yaml")
+	o := Options{
+		Dir:        filepath.Join(dir, "project"),
+		ConfigFile: configPath,
+		Defaults:   state.DefaultConfig{ClusterName: "dev"},
+	}
+	created, err := Execute(o)
+	if err != nil {
+		t.Fatalf("failed to initialize project %v", err)
+	}
+	if _, err = os.Stat(configPath); err != nil {
+		t.Fatalf("config wasn't written to the absolute path %v", err)
+	}
+	for _, p := range created {
+		if !strings.HasPrefix(p, dir) {
+			t.Fatalf("path %s is created outside of the project", p)
+		}
+	}
+}
+
+func TestExecuteWithEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-bootstrap")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	o := Options{
+		Dir:          dir,
+		Defaults:     state.DefaultConfig{ClusterName: "dev"},
+		Repositories: []state.RepositorySpec{{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"}},
+		Releases:     []state.ReleaseSpec{{Name: "prometheus", Namespace: "monitoring", Chart: "stable/prometheus", Version: "8.11.4"}},
+	}
+	created, err := Execute(o)
+	if err != nil {
+		t.Fatalf("failed to initialize project %v", err)
+	}
+	pkgPath := filepath.Join(dir, state.DefaultSourceDir, "prometheus")
+	if len(created) < 2 || created[len(created)-2] != pkgPath {
+		t.Fatalf("expected package directory to be created, got %v", created)
+	}
+	if _, err = os.Stat(filepath.Join(pkgPath, state.DefaultValuesDir)); err != nil {
+		t.Fatalf("expected values directory of the package %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, DefaultConfigFile))
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	var cs state.ClusterSpec
+	if err = yaml.Unmarshal(data, &cs); err != nil {
+		t.Fatalf("failed to parse config %v", err)
+	}
+	if diff := cmp.Diff(o.Repositories, cs.Repositories); diff != "" {
+		t.Fatalf("unexpected repositories (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(o.Releases, cs.Releases); diff != "" {
+		t.Fatalf("unexpected releases (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(string(data), "# helm chart repositories") {
+		t.Fatalf("expected comments of the config to be preserved")
+	}
+}
+
+func TestExecuteDuplicateEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-bootstrap")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	o := Options{
+		Dir:      dir,
+		Defaults: state.DefaultConfig{ClusterName: "dev"},
+		Releases: []state.ReleaseSpec{
+			{Name: "prometheus", Chart: "stable/prometheus"},
+			{Name: "prometheus", Chart: "stable/prometheus", Namespace: "staging"},
+		},
+	}
+	if _, err = Execute(o); err == nil {
+		t.Fatalf("expected error for duplicate releases")
+	}
+	if _, err = os.Stat(filepath.Join(dir, DefaultConfigFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected config not to be written, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+// helmRepository is the entry of the helm repositories.yaml or of the helmfile
+type helmRepository struct {
+	Name     string `yaml:"name"`
+	URL      string `yaml:"url"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// helmfileRelease is the subset of the helmfile release used by kube-atlas
+type helmfileRelease struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Chart     string `yaml:"chart"`
+	Version   string `yaml:"version"`
+}
+
+type helmfile struct {
+	Repositories []helmRepository  `yaml:"repositories"`
+	Releases     []helmfileRelease `yaml:"releases"`
+}
+
+var envNameRegexp = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// HelmRepositoriesPath returns location of the repositories file of helm
+func HelmRepositoriesPath(helmHome string) string {
+	return filepath.Join(helmHome, "repository", "repositories.yaml")
+}
+
+// LoadHelmRepositories reads repositories from the helm repositories.yaml
+func LoadHelmRepositories(path string) ([]state.RepositorySpec, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var f struct {
+		Repositories []helmRepository `yaml:"repositories"`
+	}
+	if err = yaml.NewDecoder(fd).Decode(&f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse helm repositories %s: %v", path, err)
+	}
+	var repos []state.RepositorySpec
+	for _, r := range f.Repositories {
+		repos = append(repos, r.spec())
+	}
+	return repos, nil
+}
+
+// LoadHelmfile reads repositories and releases from all the documents of the
+// helmfile. Templated helmfiles have to be rendered first, e.g. by "helmfile build".
+// Repositories and releases declared in several documents are returned once,
+// the first declaration wins. Local chart paths are relative to the helmfile,
+// they are returned relative to the current directory
+func LoadHelmfile(path string) ([]state.RepositorySpec, []state.ReleaseSpec, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fd.Close()
+	var repos []state.RepositorySpec
+	var releases []state.ReleaseSpec
+	seenRepos := make(map[string]bool)
+	seenReleases := make(map[string]bool)
+	dec := yaml.NewDecoder(fd)
+	for {
+		var f helmfile
+		err = dec.Decode(&f)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse helmfile %s: %v", path, err)
+		}
+		for _, r := range f.Repositories {
+			if seenRepos[r.Name] {
+				continue
+			}
+			seenRepos[r.Name] = true
+			repos = append(repos, r.spec())
+		}
+		for _, r := range f.Releases {
+			if seenReleases[r.Name] {
+				continue
+			}
+			seenReleases[r.Name] = true
+			chart := r.Chart
+			if isLocalChart(chart) && !filepath.IsAbs(chart) {
+				chart = localChart(filepath.Join(filepath.Dir(path), chart))
+			}
+			releases = append(releases, state.ReleaseSpec{
+				Name:      r.Name,
+				Namespace: r.Namespace,
+				Chart:     chart,
+				Version:   r.Version,
+			})
+		}
+	}
+	return repos, releases, nil
+}
+
+// RebaseChart makes local chart path relative to the project directory,
+// charts outside of the project aren't supported. Charts from the
+// repositories are returned as is
+func RebaseChart(dir, chart string) (string, error) {
+	if !isLocalChart(chart) {
+		return chart, nil
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absChart, err := filepath.Abs(chart)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absChart)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("chart %s is outside of the project directory %s", chart, dir)
+	}
+	return localChart(rel), nil
+}
+
+// localChart prefixes relative path with "./" to keep it a local chart reference
+func localChart(path string) string {
+	if isLocalChart(path) {
+		return filepath.ToSlash(path)
+	}
+	return "./" + filepath.ToSlash(path)
+}
+
+// isLocalChart returns true if chart is referenced by the path
+func isLocalChart(chart string) bool {
+	return chart == "." || chart == ".." || strings.HasPrefix(chart, "./") || strings.HasPrefix(chart, "../") || filepath.IsAbs(chart)
+}
+
+// spec converts repository to the config one, credentials are never copied
+// to the config, they are expected in the <NAME>_USERNAME and <NAME>_PASSWORD
+// environment variables instead
+func (r helmRepository) spec() state.RepositorySpec {
+	spec := state.RepositorySpec{
+		Name:     r.Name,
+		URL:      r.URL,
+		CertFile: r.CertFile,
+		KeyFile:  r.KeyFile,
+	}
+	if r.Username != "" || r.Password != "" {
+		prefix := strings.Trim(envNameRegexp.ReplaceAllString(strings.ToUpper(r.Name), "_"), "_")
+		spec.UsernameEnv = prefix + "_USERNAME"
+		spec.PasswordEnv = prefix + "_PASSWORD"
+	}
+	return spec
+}
@@ -0,0 +1,160 @@
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+func writeTestFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "test-import")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	path := filepath.Join(dir, "file.yaml")
+	if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadHelmRepositories(t *testing.T) {
+	path, cleanup := writeTestFile(t, `apiVersion: v1
+generated: 2019-11-20T10:00:00Z
+repositories:
+- caFile: ""
+  cache: /home/user/.helm/repository/cache/stable-index.yaml
+  certFile: ""
+  keyFile: ""
+  name: stable
+  password: ""
+  url: https://kubernetes-charts.storage.googleapis.com
+  username: ""
+- cache: /home/user/.helm/repository/cache/my-charts-index.yaml
+  certFile: /etc/certs/client.crt
+  keyFile: /etc/certs/client.key
+  name: my-charts
+  password: secret
+  url: https://charts.example.com
+  username: user
+`)
+	defer cleanup()
+	repos, err := LoadHelmRepositories(path)
+	if err != nil {
+		t.Fatalf("failed to load helm repositories %v", err)
+	}
+	exp := []state.RepositorySpec{
+		{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"},
+		{
+			Name:        "my-charts",
+			URL:         "https://charts.example.com",
+			CertFile:    "/etc/certs/client.crt",
+			KeyFile:     "/etc/certs/client.key",
+			UsernameEnv: "MY_CHARTS_USERNAME",
+			PasswordEnv: "MY_CHARTS_PASSWORD",
+		},
+	}
+	if diff := cmp.Diff(exp, repos); diff != "" {
+		t.Fatalf("unexpected repositories (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadHelmfile(t *testing.T) {
+	path, cleanup := writeTestFile(t, `repositories:
+  - name: stable
+    url: https://kubernetes-charts.storage.googleapis.com
+releases:
+  - name: prometheus
+    namespace: monitoring
+    chart: stable/prometheus
+    version: 8.11.4
+    values:
+      - values/prometheus.yaml
+      - server:
+          replicas: 2
+---
+repositories:
+  - name: jetstack
+    url: https://charts.jetstack.io
+releases:
+  - name: cert-manager
+    namespace: cert-manager
+    chart: jetstack/cert-manager
+    version: v0.12.0
+  - name: app
+    chart: ./charts/app
+---
+repositories:
+  - name: stable
+    url: https://charts.helm.sh/stable
+releases:
+  - name: prometheus
+    namespace: monitoring-staging
+    chart: stable/prometheus
+`)
+	defer cleanup()
+	repos, releases, err := LoadHelmfile(path)
+	if err != nil {
+		t.Fatalf("failed to load helmfile %v", err)
+	}
+	expRepos := []state.RepositorySpec{
+		{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"},
+		{Name: "jetstack", URL: "https://charts.jetstack.io"},
+	}
+	if diff := cmp.Diff(expRepos, repos); diff != "" {
+		t.Fatalf("unexpected repositories (-want +got):\n%s", diff)
+	}
+	expReleases := []state.ReleaseSpec{
+		{Name: "prometheus", Namespace: "monitoring", Chart: "stable/prometheus", Version: "8.11.4"},
+		{Name: "cert-manager", Namespace: "cert-manager", Chart: "jetstack/cert-manager", Version: "v0.12.0"},
+		{Name: "app", Chart: filepath.Join(filepath.Dir(path), "charts", "app")},
+	}
+	if diff := cmp.Diff(expReleases, releases); diff != "" {
+		t.Fatalf("unexpected releases (-want +got):\n%s", diff)
+	}
+
+	templated, cleanupTemplated := writeTestFile(t, "releases:\n{{ range .Values.apps }}\n  - name: {{ . }}\n{{ end }}\n")
+	defer cleanupTemplated()
+	if _, _, err = LoadHelmfile(templated); err == nil {
+		t.Fatalf("expected error for templated helmfile")
+	}
+}
+
+func TestRebaseChart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-import")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	project := filepath.Join(dir, "project")
+	tests := []struct {
+		chart string
+		exp   string
+		err   bool
+	}{
+		{chart: "stable/prometheus", exp: "stable/prometheus"},
+		{chart: filepath.Join(project, "charts", "app"), exp: "./charts/app"},
+		{chart: filepath.Join(project, "helmfile", "..", "app"), exp: "./app"},
+		{chart: filepath.Join(dir, "charts", "app"), err: true},
+	}
+	for _, tc := range tests {
+		chart, err := RebaseChart(project, tc.chart)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("expected error for chart %s, got %s", tc.chart, chart)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to rebase chart %s: %v", tc.chart, err)
+		}
+		if chart != tc.exp {
+			t.Fatalf("expected chart %s, got %s", tc.exp, chart)
+		}
+	}
+}
@@ -2,70 +2,219 @@ package bootstrap
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/manifoldco/promptui"
+	"github.com/rs/zerolog/log"
+
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/state"
 )
 
-func Interactive() {
-	/*
-		- enter project dir
-		- enter cluster name
-		- do you want to import helm repositories installed in the system?
-		- do you want to import releases from the helmfile
-	*/
+// multiSelectDone is the first item of the multi-select which finishes the selection
+const multiSelectDone = "Done"
 
+// Interactive asks for the project directory, cluster name, repositories
+// and releases to import and creates the project using the answers.
+// Options are used as defaults, summary of the created files is printed
+func Interactive(o Options) error {
 	prompt := promptui.Prompt{
 		Label:   "Please enter the path for your project ",
 		Default: ".",
 	}
-	result, err := prompt.Run()
+	dir, err := prompt.Run()
 	if err != nil {
-		fmt.Printf("Prompt failed %v\n", err)
-		return
+		return err
 	}
-	fmt.Printf("You choose %q\n", result)
+	o.Dir = dir
 
+	clusterName := o.Defaults.ClusterName
+	if clusterName == "" {
+		clusterName = "dev"
+	}
 	prompt = promptui.Prompt{
 		Label:   "Name of the cluster used by default, used to populate directory tree ",
-		Default: "dev",
+		Default: clusterName,
 	}
-	result, err = prompt.Run()
-	if err != nil {
-		fmt.Printf("Prompt failed %v\n", err)
-		return
+	if o.Defaults.ClusterName, err = prompt.Run(); err != nil {
+		return err
 	}
-	fmt.Printf("You choose %q\n", result)
 
-	prompt = promptui.Prompt{
-		Label:     "Do you want to import helm repositories installed in the system? ",
-		IsConfirm: true,
-	}
-	result, err = prompt.Run()
-	if err != nil && err != promptui.ErrAbort {
-		fmt.Printf("Prompt failed %v\n", err)
-		return
+	configPath := o.configPath()
+	if _, err = os.Stat(configPath); err == nil && !o.Force {
+		if o.Force, err = confirm(fmt.Sprintf("Config %s already exists, do you want to overwrite it? ", configPath)); err != nil {
+			return err
+		}
+		if !o.Force {
+			return fmt.Errorf("config %s already exists", configPath)
+		}
 	}
-	fmt.Printf("You choose %q\n", result)
 
-	prompt = promptui.Prompt{
-		Label:     "Do you want to import releases from the helmfile? ",
-		IsConfirm: true,
+	var repos []state.RepositorySpec
+	ok, err := confirm("Do you want to import helm repositories installed in the system? ")
+	if err != nil {
+		return err
 	}
-	result, err = prompt.Run()
-	if err != nil && err != promptui.ErrAbort {
-		fmt.Printf("Prompt failed %v\n", err)
-		return
+	if ok {
+		path := HelmRepositoriesPath(helmHome())
+		helmRepos, err := LoadHelmRepositories(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("failed to read helm repositories")
+		}
+		repos = append(repos, helmRepos...)
+	}
+
+	var releases []state.ReleaseSpec
+	if ok, err = confirm("Do you want to import releases from the helmfile? "); err != nil {
+		return err
 	}
-	fmt.Printf("You choose %q\n", result)
-	if result == "y" {
+	if ok {
 		prompt = promptui.Prompt{
 			Label:   "Please enter the path to your helmfile",
 			Default: "./helmfile.yaml",
 		}
-		result, err = prompt.Run()
+		path, err := prompt.Run()
 		if err != nil {
-			fmt.Printf("Prompt failed %v\n", err)
-			return
+			return err
+		}
+		helmfileRepos, helmfileReleases, err := LoadHelmfile(path)
+		if err != nil {
+			return err
+		}
+		for _, r := range helmfileRepos {
+			if !hasRepository(repos, r.Name) {
+				repos = append(repos, r)
+			}
+		}
+		for _, r := range helmfileReleases {
+			if r.Chart, err = RebaseChart(o.Dir, r.Chart); err != nil {
+				log.Warn().Err(err).Str("release", r.Name).Msg("release with the local chart is skipped")
+				continue
+			}
+			releases = append(releases, r)
+		}
+	}
+
+	if len(repos) > 0 {
+		items := make([]string, len(repos))
+		for i, r := range repos {
+			items[i] = fmt.Sprintf("%s (%s)", r.Name, r.URL)
+		}
+		selected, err := multiSelect("Select repositories to add to the config", items)
+		if err != nil {
+			return err
+		}
+		for _, i := range selected {
+			o.Repositories = append(o.Repositories, repos[i])
+		}
+	}
+	if len(releases) > 0 {
+		items := make([]string, len(releases))
+		for i, r := range releases {
+			items[i] = fmt.Sprintf("%s (%s)", r.Name, strings.TrimSpace(r.Chart+" "+r.Version))
+		}
+		selected, err := multiSelect("Select releases to add to the config", items)
+		if err != nil {
+			return err
+		}
+		for _, i := range selected {
+			o.Releases = append(o.Releases, releases[i])
+		}
+	}
+
+	created, err := Execute(o)
+	printSummary(created, o.Repositories)
+	return err
+}
+
+// confirm asks yes/no question, "no" is not an error
+func confirm(label string) (bool, error) {
+	prompt := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+	_, err := prompt.Run()
+	if err == promptui.ErrAbort {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// multiSelect lets user toggle items one by one, all the items are selected by
+// default. Returns indexes of the selected items
+func multiSelect(label string, items []string) ([]int, error) {
+	selected := make([]bool, len(items))
+	for i := range selected {
+		selected[i] = true
+	}
+	for {
+		options := []string{multiSelectDone}
+		for i, item := range items {
+			mark := "[ ]"
+			if selected[i] {
+				mark = "[x]"
+			}
+			options = append(options, mark+" "+item)
+		}
+		s := promptui.Select{
+			Label: label + " (toggle with enter)",
+			Items: options,
+			Size:  10,
+		}
+		i, _, err := s.Run()
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			break
+		}
+		selected[i-1] = !selected[i-1]
+	}
+	var result []int
+	for i, ok := range selected {
+		if ok {
+			result = append(result, i)
+		}
+	}
+	return result, nil
+}
+
+// helmHome returns home directory of helm, $HELM_HOME or ~/.helm
+// are used if helm is not available
+func helmHome() string {
+	home, err := exec_helm.NewExecHelm(&log.Logger).Home()
+	if err == nil && home != "" {
+		return home
+	}
+	if home = os.Getenv("HELM_HOME"); home != "" {
+		return home
+	}
+	return filepath.Join(os.Getenv("HOME"), ".helm")
+}
+
+func hasRepository(repos []state.RepositorySpec, name string) bool {
+	for _, r := range repos {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printSummary lists created files and environment variables expected
+// by the imported repositories
+func printSummary(created []string, repos []state.RepositorySpec) {
+	if len(created) > 0 {
+		fmt.Println("Created files and directories:")
+		for _, p := range created {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	for _, r := range repos {
+		if r.UsernameEnv != "" {
+			fmt.Printf("Credentials of the repository %s are read from %s and %s environment variables\n", r.Name, r.UsernameEnv, r.PasswordEnv)
 		}
-		fmt.Printf("You choose %q\n", result)
 	}
 }
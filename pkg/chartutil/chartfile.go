@@ -0,0 +1,42 @@
+package chartutil
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// ChartfileName is the name of the chart metadata file
+const ChartfileName = "Chart.yaml"
+
+// Metadata is the subset of the Chart.yaml used by kube-atlas
+type Metadata struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion,omitempty"`
+}
+
+// LoadChartfile reads chart metadata from the Chart.yaml file
+func LoadChartfile(name string) (*Metadata, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var m Metadata
+	if err = yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// LoadDir reads chart metadata from the chart directory
+func LoadDir(dir string) (*Metadata, error) {
+	return LoadChartfile(filepath.Join(dir, ChartfileName))
+}
+
+// VersionsEqual compares chart versions ignoring the leading "v"
+func VersionsEqual(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
@@ -0,0 +1,48 @@
+package chartutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-chart")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	content := "apiVersion: v1\nname: prometheus\nversion: 8.11.4\nappVersion: 2.9.2\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, ChartfileName), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write chart file %v", err)
+	}
+	meta, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to load chart metadata %v", err)
+	}
+	exp := &Metadata{Name: "prometheus", Version: "8.11.4", AppVersion: "2.9.2"}
+	if diff := cmp.Diff(exp, meta); diff != "" {
+		t.Fatalf("unexpected chart metadata (-want +got):\n%s", diff)
+	}
+}
+
+func TestVersionsEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		exp  bool
+	}{
+		{"8.11.4", "8.11.4", true},
+		{"v0.9.1", "0.9.1", true},
+		{"0.9.1", "v0.9.1", true},
+		{"8.11.4", "8.11.5", false},
+		{"8.11.4", "", false},
+	}
+	for _, tt := range tests {
+		if got := VersionsEqual(tt.a, tt.b); got != tt.exp {
+			t.Fatalf("expected VersionsEqual(%q, %q) to be %v", tt.a, tt.b, tt.exp)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package chartutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// RequirementsName is the name of the dependencies file of the helm2 charts
+	RequirementsName = "requirements.yaml"
+	// ChartsDir is the directory with the vendored dependencies of the chart
+	ChartsDir = "charts"
+)
+
+// Dependency is the chart declared as a dependency in Chart.yaml or requirements.yaml
+type Dependency struct {
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	Repository string `json:"repository,omitempty"`
+}
+
+// dependencies is the subset of both Chart.yaml (apiVersion v2) and requirements.yaml
+type dependencies struct {
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// LoadDependencies returns dependencies declared by the chart in the directory
+func LoadDependencies(dir string) ([]Dependency, error) {
+	var deps []Dependency
+	for _, name := range []string{ChartfileName, RequirementsName} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var d dependencies
+		if err = yaml.Unmarshal(data, &d); err != nil {
+			return nil, err
+		}
+		deps = append(deps, d.Dependencies...)
+	}
+	return deps, nil
+}
+
+// VendoredDependencies returns metadata of the charts present in the charts
+// directory of the chart, both unpacked and archived ones, sorted by name
+func VendoredDependencies(dir string) ([]Metadata, error) {
+	fls, err := ioutil.ReadDir(filepath.Join(dir, ChartsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var vendored []Metadata
+	for _, f := range fls {
+		p := filepath.Join(dir, ChartsDir, f.Name())
+		var m *Metadata
+		switch {
+		case f.IsDir():
+			m, err = LoadDir(p)
+			if os.IsNotExist(err) {
+				continue
+			}
+		case strings.HasSuffix(f.Name(), ".tgz"):
+			m, err = loadArchive(p)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		vendored = append(vendored, *m)
+	}
+	sort.Slice(vendored, func(i, j int) bool {
+		return vendored[i].Name < vendored[j].Name
+	})
+	return vendored, nil
+}
+
+// MissingDependencies returns dependencies of the chart which are not vendored
+func MissingDependencies(dir string) ([]Dependency, error) {
+	deps, err := LoadDependencies(dir)
+	if err != nil || len(deps) == 0 {
+		return nil, err
+	}
+	vendored, err := VendoredDependencies(dir)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(vendored))
+	for _, m := range vendored {
+		present[m.Name] = true
+	}
+	var missing []Dependency
+	for _, d := range deps {
+		if !present[d.Name] {
+			missing = append(missing, d)
+		}
+	}
+	return missing, nil
+}
+
+// DependencyNames returns names of the dependencies
+func DependencyNames(deps []Dependency) []string {
+	names := make([]string, 0, len(deps))
+	for _, d := range deps {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// loadArchive reads chart metadata from the chart archive
+func loadArchive(name string) (*Metadata, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	gz, err := gzip.NewReader(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("chart archive %s doesn't contain %s", name, ChartfileName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Chart.yaml of the chart itself, not of its own dependencies
+		parts := strings.Split(path.Clean(hdr.Name), "/")
+		if len(parts) != 2 || parts[1] != ChartfileName {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		var m Metadata
+		if err = yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return &m, nil
+	}
+}
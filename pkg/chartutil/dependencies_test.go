@@ -0,0 +1,78 @@
+package chartutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/internal/testutil"
+)
+
+func TestMissingDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-chart")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		ChartfileName:                     "apiVersion: v1\nname: prometheus\nversion: 8.11.4\n",
+		RequirementsName:                  "dependencies:\n- name: kube-state-metrics\n  version: 1.6.x\n  repository: https://kubernetes-charts.storage.googleapis.com\n- name: node-exporter\n  version: 1.2.0\n  repository: \"@stable\"\n- name: grafana\n  version: 3.5.0\n  repository: \"@stable\"\n",
+		"charts/node-exporter/Chart.yaml": "apiVersion: v1\nname: node-exporter\nversion: 1.2.0\n",
+	}
+	for name, content := range files {
+		if err = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatalf("failed to create directory %v", err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file %v", err)
+		}
+	}
+	archive := testutil.Archive(t, map[string]string{
+		"kube-state-metrics/" + ChartfileName: "apiVersion: v1\nname: kube-state-metrics\nversion: 1.6.1\n",
+	})
+	if err = ioutil.WriteFile(filepath.Join(dir, ChartsDir, "kube-state-metrics-1.6.1.tgz"), archive, 0644); err != nil {
+		t.Fatalf("failed to write archive %v", err)
+	}
+
+	missing, err := MissingDependencies(dir)
+	if err != nil {
+		t.Fatalf("failed to find missing dependencies %v", err)
+	}
+	exp := []Dependency{{Name: "grafana", Version: "3.5.0", Repository: "@stable"}}
+	if diff := cmp.Diff(exp, missing); diff != "" {
+		t.Fatalf("unexpected missing dependencies (-want +got):\n%s", diff)
+	}
+	vendored, err := VendoredDependencies(dir)
+	if err != nil {
+		t.Fatalf("failed to read vendored dependencies %v", err)
+	}
+	expVendored := []Metadata{
+		{Name: "kube-state-metrics", Version: "1.6.1"},
+		{Name: "node-exporter", Version: "1.2.0"},
+	}
+	if diff := cmp.Diff(expVendored, vendored); diff != "" {
+		t.Fatalf("unexpected vendored dependencies (-want +got):\n%s", diff)
+	}
+}
+
+func TestMissingDependenciesWithoutDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-chart")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	content := "apiVersion: v2\nname: app\nversion: 0.1.0\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, ChartfileName), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write chart file %v", err)
+	}
+	missing, err := MissingDependencies(dir)
+	if err != nil {
+		t.Fatalf("failed to find missing dependencies %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("expected no missing dependencies, got %v", missing)
+	}
+}
@@ -0,0 +1,71 @@
+package exec_git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/lwolf/kube-atlas/pkg/exec"
+)
+
+const (
+	command = "git"
+)
+
+type execer struct {
+	binary string
+	runner exec.Runner
+	logger *zerolog.Logger
+}
+
+// New for running git commands
+func NewExecGit(logger *zerolog.Logger) *execer {
+	return &execer{
+		binary: command,
+		logger: logger,
+		runner: &exec.ShellRunner{
+			Logger: logger,
+		},
+	}
+}
+
+func (e *execer) SetBinary(bin string) {
+	e.binary = bin
+}
+
+// Clone clones repository into the directory without checking out files
+func (e *execer) Clone(url, dir string) error {
+	e.logger.Info().Msgf("Cloning %v", exec.MaskURL(url))
+	out, err := e.exec([]string{"clone", "--quiet", "--no-checkout", "--", url, dir})
+	e.write(out)
+	return err
+}
+
+// Checkout checks out the commit in the repository directory
+func (e *execer) Checkout(dir, commit string) error {
+	out, err := e.exec([]string{"-C", dir, "checkout", "--quiet", "--detach", commit})
+	e.write(out)
+	return err
+}
+
+// RevParse resolves reference to the commit hash
+func (e *execer) RevParse(dir, ref string) (string, error) {
+	out, err := e.exec([]string{"-C", dir, "rev-parse", "--verify", "--quiet", ref + "^{commit}"})
+	return strings.TrimSpace(string(out)), err
+}
+
+func (e *execer) exec(args []string) ([]byte, error) {
+	cmd := fmt.Sprintf("exec: %s %s", e.binary, strings.Join(exec.MaskArgs(args), " "))
+	e.logger.Debug().Msg(cmd)
+	// never wait for credentials on the terminal
+	bytes, err := e.runner.Execute(e.binary, args, map[string]string{"GIT_TERMINAL_PROMPT": "0"})
+	e.logger.Debug().Msgf("%s: %s", cmd, bytes)
+	return bytes, err
+}
+
+func (e *execer) write(out []byte) {
+	if len(out) > 0 {
+		e.logger.Debug().Msgf("%s\n", out)
+	}
+}
@@ -47,12 +47,20 @@ func (helm *helmExecer) AddRepo(name, repository, certfile, keyfile, username, p
 	if username != "" && password != "" {
 		args = append(args, "--username", username, "--password", password)
 	}
-	helm.logger.Info().Msgf("Adding repo %v %v", name, repository)
+	helm.logger.Info().Msgf("Adding repo %v %v", name, exec.MaskURL(repository))
 	out, err := helm.exec(args, map[string]string{})
 	helm.info(out)
 	return err
 }
 
+// RemoveRepo removes repository from the helm repositories
+func (helm *helmExecer) RemoveRepo(name string) error {
+	helm.logger.Info().Msgf("Removing repo %v", name)
+	out, err := helm.exec([]string{"repo", "remove", name}, map[string]string{})
+	helm.info(out)
+	return err
+}
+
 func (helm *helmExecer) UpdateRepo() error {
 	helm.logger.Info().Msg("Updating repo")
 	out, err := helm.exec([]string{"repo", "update"}, map[string]string{})
@@ -94,12 +102,24 @@ func (helm *helmExecer) TemplateRelease(chart string, flags ...string) error {
 	return err
 }
 
+// Version returns version of the helm client
+func (helm *helmExecer) Version() (string, error) {
+	out, err := helm.exec([]string{"version", "--client", "--short"}, map[string]string{})
+	return strings.TrimSpace(string(out)), err
+}
+
+// Home returns location of the helm home directory
+func (helm *helmExecer) Home() (string, error) {
+	out, err := helm.exec([]string{"home"}, map[string]string{})
+	return strings.TrimSpace(string(out)), err
+}
+
 func (helm *helmExecer) exec(args []string, env map[string]string) ([]byte, error) {
 	cmdargs := args
 	if len(helm.extra) > 0 {
 		cmdargs = append(cmdargs, helm.extra...)
 	}
-	cmd := fmt.Sprintf("exec: %s %s", helm.binary, strings.Join(cmdargs, " "))
+	cmd := fmt.Sprintf("exec: %s %s", helm.binary, strings.Join(exec.MaskArgs(cmdargs), " "))
 	helm.logger.Debug().Msg(cmd)
 	bytes, err := helm.runner.Execute(helm.binary, cmdargs, env)
 	helm.logger.Debug().Msgf("%s: %s", cmd, bytes)
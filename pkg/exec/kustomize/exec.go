@@ -57,6 +57,12 @@ func (e *execer) Build(chart string, flags ...string) error {
 	return err
 }
 
+// Version returns version of the kustomize binary
+func (e *execer) Version() (string, error) {
+	out, err := e.exec([]string{"version"}, map[string]string{})
+	return strings.TrimSpace(string(out)), err
+}
+
 func (e *execer) info(out []byte) {
 	if len(out) > 0 {
 		e.logger.Info().Msgf("%s", out)
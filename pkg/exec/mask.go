@@ -0,0 +1,30 @@
+package exec
+
+import (
+	"regexp"
+	"strings"
+)
+
+// userinfoRegexp matches credentials embedded into the url
+var userinfoRegexp = regexp.MustCompile(`://[^/@\s]+@`)
+
+// MaskURL hides credentials embedded into the url
+func MaskURL(s string) string {
+	return userinfoRegexp.ReplaceAllString(s, "://***@")
+}
+
+// MaskArgs hides passwords and credentials embedded into urls
+// to make command arguments safe for logging
+func MaskArgs(args []string) []string {
+	masked := make([]string, len(args))
+	for i, a := range args {
+		switch {
+		case i > 0 && args[i-1] == "--password":
+			a = "***"
+		case strings.HasPrefix(a, "--password="):
+			a = "--password=***"
+		}
+		masked[i] = MaskURL(a)
+	}
+	return masked
+}
@@ -0,0 +1,392 @@
+package fetch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lwolf/kube-atlas/pkg/chartutil"
+	"github.com/lwolf/kube-atlas/pkg/exec"
+	exec_git "github.com/lwolf/kube-atlas/pkg/exec/git"
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	"github.com/lwolf/kube-atlas/pkg/fileutil"
+	"github.com/lwolf/kube-atlas/pkg/lock"
+	"github.com/lwolf/kube-atlas/pkg/oci"
+	"github.com/lwolf/kube-atlas/pkg/repo"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+var (
+	// cacheDir is the directory with cached indexes of the repositories
+	cacheDir = repo.DefaultCacheDir()
+	// ociHTTPClient is used to pull charts from the OCI registries
+	ociHTTPClient = http.DefaultClient
+)
+
+// VendoredVersion returns version of the chart currently present
+// in the package, empty string if there is no chart
+func VendoredVersion(release *state.ReleaseSpec, s *state.ClusterSpec) string {
+	chartPath, err := release.GetChartPath(&s.Defaults)
+	if err != nil {
+		return ""
+	}
+	meta, err := chartutil.LoadDir(chartPath)
+	if err != nil {
+		return ""
+	}
+	return meta.Version
+}
+
+// SameSource checks whether the chart recorded in the lock entry was fetched
+// from the source configured for the release, e.g. chart wasn't moved to another
+// repository or git ref wasn't changed. Missing entry never matches
+func SameSource(entry *lock.Entry, release *state.ReleaseSpec, s *state.ClusterSpec) bool {
+	if entry == nil {
+		return false
+	}
+	switch release.SourceType() {
+	case state.SourceTypeGit:
+		return entry.Repository == release.Git.URL && entry.Ref == release.Git.Ref && entry.Path == release.Git.Path
+	case state.SourceTypeOCI:
+		return entry.Repository == release.Chart
+	}
+	var url string
+	if spec := s.RepositoryByName(release.RepositoryName()); spec != nil {
+		url = spec.URL
+	}
+	return entry.Repository == url && entry.Chart == release.ChartName()
+}
+
+// Release downloads chart of the release into the package chart
+// directory and returns the lock entry describing it
+func Release(release *state.ReleaseSpec, s *state.ClusterSpec) (*lock.Entry, error) {
+	switch release.SourceType() {
+	case state.SourceTypeNone:
+		return nil, fmt.Errorf("release %s has neither chart nor git source", release.Name)
+	case state.SourceTypeLocal:
+		return nil, fmt.Errorf("release %s uses local chart, it can't be fetched", release.Name)
+	}
+	chartPath, err := release.GetChartPath(&s.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct chart directory for package: %v", err)
+	}
+
+	// make sure that directory structure exists
+	err = release.InitDirs(&s.Defaults)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to populate directories for package")
+	}
+	destTmp, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		return nil, fmt.Errorf("failed create temp directory: %v", err)
+	}
+	defer os.RemoveAll(destTmp)
+
+	var chartTmp, digest, commit string
+	if release.SourceType() == state.SourceTypeGit {
+		chartTmp, commit, err = cloneSource(release, destTmp)
+	} else {
+		chartTmp, digest, err = fetchArchive(release, s, destTmp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &lock.Entry{
+		Name:   release.Name,
+		Commit: commit,
+	}
+	if digest != "" {
+		entry.Digest = "sha256:" + digest
+	}
+	meta, err := chartutil.LoadDir(chartTmp)
+	switch {
+	case err == nil:
+		entry.Chart, entry.Version = meta.Name, meta.Version
+		if entry.Dependencies, err = vendorDependencies(chartTmp); err != nil {
+			return nil, err
+		}
+	case release.SourceType() == state.SourceTypeGit && os.IsNotExist(err):
+		// kustomize base or raw manifests
+		entry.Chart, entry.Version = release.Name, release.Git.Ref
+		if release.Git.Path != "" {
+			entry.Chart = filepath.Base(release.Git.Path)
+		}
+	default:
+		return nil, fmt.Errorf("failed to read chart metadata: %v", err)
+	}
+
+	if err := os.RemoveAll(chartPath); err != nil {
+		log.Error().Err(err).Msg("failed to remove files before update")
+	}
+	log.Debug().Str("src", chartTmp).Str("dest", chartPath).Msg("moving chart to destination")
+	if err := os.Rename(chartTmp, chartPath); err != nil {
+		return nil, fmt.Errorf("failed to move chart: %v", err)
+	}
+	entry.TreeHash, err = fileutil.HashDir(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate tree hash of the chart: %v", err)
+	}
+	switch release.SourceType() {
+	case state.SourceTypeGit:
+		entry.Repository, entry.Ref, entry.Path = release.Git.URL, release.Git.Ref, release.Git.Path
+	case state.SourceTypeOCI:
+		entry.Repository = release.Chart
+	default:
+		if spec := s.RepositoryByName(release.RepositoryName()); spec != nil {
+			entry.Repository = spec.URL
+		}
+	}
+	return entry, nil
+}
+
+// fetchArchive downloads chart archive and extracts it into the directory,
+// returns path of the chart directory and sha256 of the archive
+func fetchArchive(release *state.ReleaseSpec, s *state.ClusterSpec, dir string) (string, string, error) {
+	var archive string
+	var err error
+	if release.SourceType() == state.SourceTypeOCI {
+		archive, err = pullChart(release, s, dir)
+	} else if spec := s.RepositoryByName(release.RepositoryName()); spec != nil {
+		archive, err = downloadChart(release, *spec, dir)
+	} else {
+		// repository is not defined in the config, rely on the helm repositories
+		archive, err = helmFetch(release, dir)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	digest, err := fileutil.HashFile(archive)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to calculate digest of the chart archive: %v", err)
+	}
+	untarDir := filepath.Join(dir, "untar")
+	if err = fileutil.UntarFile(archive, untarDir); err != nil {
+		return "", "", fmt.Errorf("failed to extract chart archive: %v", err)
+	}
+	files, err := ioutil.ReadDir(untarDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read tmp directory with the chart: %v", err)
+	}
+	if len(files) != 1 {
+		return "", "", fmt.Errorf("failed to find chart directory after fetching")
+	}
+	return filepath.Join(untarDir, files[0].Name()), digest, nil
+}
+
+// cloneSource clones git repository of the release into the directory and checks out
+// the ref, returns path of the source directory inside of the repository and the commit
+func cloneSource(release *state.ReleaseSpec, dir string) (string, string, error) {
+	repoDir := filepath.Join(dir, "git")
+	git := exec_git.NewExecGit(&log.Logger)
+	if err := git.Clone(release.Git.URL, repoDir); err != nil {
+		return "", "", fmt.Errorf("failed to clone %s: %v", exec.MaskURL(release.Git.URL), err)
+	}
+	ref := release.Git.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commit, err := git.RevParse(repoDir, ref)
+	if err != nil {
+		// branches exist only as remote ones in the fresh clone
+		commit, err = git.RevParse(repoDir, "origin/"+ref)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find ref %s in %s", ref, exec.MaskURL(release.Git.URL))
+	}
+	if err = git.Checkout(repoDir, commit); err != nil {
+		return "", "", fmt.Errorf("failed to checkout %s: %v", commit, err)
+	}
+	if err = os.RemoveAll(filepath.Join(repoDir, ".git")); err != nil {
+		return "", "", err
+	}
+	srcDir, err := securejoin.SecureJoin(repoDir, release.Git.Path)
+	if err != nil {
+		return "", "", err
+	}
+	if ok, err := fileutil.IsDir(srcDir); err != nil || !ok {
+		return "", "", fmt.Errorf("path %s is not a directory in %s at %s", release.Git.Path, exec.MaskURL(release.Git.URL), commit)
+	}
+	log.Info().Str("release", release.Name).Str("commit", commit).Msg("checked out git source")
+	return srcDir, commit, nil
+}
+
+// vendorDependencies makes sure that dependencies declared by the chart are present
+// in its charts directory, missing ones are downloaded by helm. Returns all the
+// charts vendored into the charts directory
+func vendorDependencies(chartDir string) ([]lock.Dependency, error) {
+	declared, err := chartutil.LoadDependencies(chartDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart dependencies: %v", err)
+	}
+	missing, err := chartutil.MissingDependencies(chartDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart dependencies: %v", err)
+	}
+	if len(missing) > 0 {
+		helm := exec_helm.NewExecHelm(&log.Logger)
+		// build uses versions pinned by the lock file of the chart, update resolves them
+		if fileutil.Exists(filepath.Join(chartDir, "requirements.lock")) || fileutil.Exists(filepath.Join(chartDir, "Chart.lock")) {
+			err = helm.BuildDeps(chartDir)
+		} else {
+			err = helm.UpdateDeps(chartDir)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to vendor chart dependencies: %v", err)
+		}
+		if missing, err = chartutil.MissingDependencies(chartDir); err != nil {
+			return nil, fmt.Errorf("failed to read chart dependencies: %v", err)
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("chart dependencies %s are missing after helm dependency update", strings.Join(chartutil.DependencyNames(missing), ", "))
+		}
+	}
+	vendored, err := chartutil.VendoredDependencies(chartDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vendored chart dependencies: %v", err)
+	}
+	repositories := make(map[string]string, len(declared))
+	for _, d := range declared {
+		repositories[d.Name] = exec.MaskURL(d.Repository)
+	}
+	var deps []lock.Dependency
+	for _, m := range vendored {
+		deps = append(deps, lock.Dependency{Name: m.Name, Version: m.Version, Repository: repositories[m.Name]})
+	}
+	return deps, nil
+}
+
+// downloadChart resolves chart version using index of the repository
+// and downloads chart archive into the directory
+func downloadChart(release *state.ReleaseSpec, spec state.RepositorySpec, dir string) (string, error) {
+	client, err := repo.NewClient(spec, cacheDir)
+	if err != nil {
+		return "", err
+	}
+	cv, err := client.Resolve(release.ChartName(), release.Version, release.Devel)
+	if err != nil {
+		return "", err
+	}
+	log.Info().Str("repository", spec.Name).Str("chart", cv.Name).Str("version", cv.Version).Msg("downloading chart")
+	archive := filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", cv.Name, cv.Version))
+	fd, err := os.Create(archive)
+	if err != nil {
+		return "", err
+	}
+	err = client.Download(cv, fd)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download chart %s: %v", release.Chart, err)
+	}
+	if cv.Digest != "" {
+		digest, err := fileutil.HashFile(archive)
+		if err != nil {
+			return "", err
+		}
+		if digest != strings.TrimPrefix(cv.Digest, "sha256:") {
+			return "", fmt.Errorf("digest of the chart %s doesn't match the repository index", release.Chart)
+		}
+	}
+	return archive, nil
+}
+
+// pullChart pulls chart archive from the OCI registry into the directory, credentials
+// are taken from the repository which url is the prefix of the chart reference
+func pullChart(release *state.ReleaseSpec, s *state.ClusterSpec, dir string) (string, error) {
+	ref, err := oci.ParseReference(release.Chart)
+	if err != nil {
+		return "", err
+	}
+	var username, password string
+	spec, err := s.RepositoryByURLPrefix(release.Chart)
+	if err != nil {
+		return "", err
+	}
+	if spec != nil {
+		username, password = spec.Username, spec.Password
+	}
+	log.Info().Str("chart", ref.String()).Str("version", release.Version).Msg("pulling chart")
+	archive := filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", release.ChartName(), release.Version))
+	fd, err := os.Create(archive)
+	if err != nil {
+		return "", err
+	}
+	_, err = oci.NewClient(username, password, ociHTTPClient).Pull(ref, release.Version, fd)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to pull chart %s: %v", release.Chart, err)
+	}
+	return archive, nil
+}
+
+// helmFetch downloads chart archive into the directory using helm
+func helmFetch(release *state.ReleaseSpec, dir string) (string, error) {
+	fetchFlags := []string{}
+	if release.Version != "" {
+		fetchFlags = append(fetchFlags, "--version", release.Version)
+	}
+	if release.Devel {
+		fetchFlags = append(fetchFlags, "--devel")
+	}
+	log.Debug().Msgf("going to fetch chart from %s", release.Chart)
+	helm := exec_helm.NewExecHelm(&log.Logger)
+	fetchFlags = append(fetchFlags, "--destination", dir)
+	log.Info().Strs("fetchFlags", fetchFlags).Msg("fetch flags:")
+	if err := helm.Fetch(release.Chart, fetchFlags...); err != nil {
+		return "", err
+	}
+	archives, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return "", err
+	}
+	if len(archives) != 1 {
+		return "", fmt.Errorf("expected to find single chart archive after fetching, found %d", len(archives))
+	}
+	return archives[0], nil
+}
+
+// Verify makes sure that vendored charts weren't modified since they were
+// fetched, modification of releases marked as dirty is reported but allowed
+func Verify(releases []state.ReleaseSpec, s *state.ClusterSpec, lf *lock.File) error {
+	var failed []string
+	for _, release := range releases {
+		rlog := log.With().Str("release", release.Name).Logger()
+		if t := release.SourceType(); t == state.SourceTypeNone || t == state.SourceTypeLocal {
+			rlog.Debug().Msg("release has no remote chart source, skipping")
+			continue
+		}
+		entry := lf.Get(release.Name)
+		if entry == nil {
+			rlog.Error().Msg("release is not present in the lock file, fetch it first")
+			failed = append(failed, release.Name)
+			continue
+		}
+		chartPath, err := release.GetChartPath(&s.Defaults)
+		if err != nil {
+			return err
+		}
+		if err = entry.Verify(chartPath); err != nil {
+			if release.Dirty {
+				rlog.Warn().Err(err).Msg("chart was modified, release is marked as dirty")
+				continue
+			}
+			rlog.Error().Err(err).Msg("chart was modified, mark release as dirty or fetch it again")
+			failed = append(failed, release.Name)
+			continue
+		}
+		rlog.Info().Str("version", entry.Version).Msg("chart matches the lock file")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("verification failed for releases: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
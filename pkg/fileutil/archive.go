@@ -0,0 +1,95 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+)
+
+// HashFile calculates sha256 of the file content
+func HashFile(name string) (string, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Untar extracts gzipped tarball into the destination directory.
+// Entries pointing outside of the destination are rejected
+func Untar(r io.Reader, dst string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := securejoin.SecureJoin(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(dst, target); err != nil || rel == "." {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err = writeFile(target, tr, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported type of the archive entry %s", hdr.Name)
+		}
+	}
+}
+
+// UntarFile extracts gzipped tarball file into the destination directory
+func UntarFile(name, dst string) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return Untar(fd, dst)
+}
+
+func writeFile(name string, r io.Reader, perm os.FileMode) error {
+	if perm == 0 {
+		perm = 0644
+	}
+	fd, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, r); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
@@ -1,6 +1,7 @@
 package fileutil
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -8,6 +9,8 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/rs/zerolog/log"
+
+	"github.com/lwolf/kube-atlas/internal/testutil"
 )
 
 func TestCopyDirWithPrefix(t *testing.T) {
@@ -77,3 +80,76 @@ func TestCopyDirWithFiles(t *testing.T) {
 		t.Fatalf("expected to get following files %v, but got %v", srcFiles, dstFiles)
 	}
 }
+
+func TestHashDir(t *testing.T) {
+	src, err := ioutil.TempDir("", "test-hash")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(src)
+	_ = os.MkdirAll(filepath.Join(src, "templates"), 0755)
+	err = ioutil.WriteFile(filepath.Join(src, "templates", "a.yaml"), []byte("a: b"), 0644)
+	if err != nil {
+		t.Fatalf("failed to create test file %v", err)
+	}
+	h1, err := HashDir(src)
+	if err != nil {
+		t.Fatalf("failed to hash directory %v", err)
+	}
+	h2, _ := HashDir(src)
+	if h1 != h2 {
+		t.Fatalf("expected hash to be stable, got %s and %s", h1, h2)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "templates", "a.yaml"), []byte("a: c"), 0644)
+	if err != nil {
+		t.Fatalf("failed to update test file %v", err)
+	}
+	h3, _ := HashDir(src)
+	if h1 == h3 {
+		t.Fatal("expected hash to change after file modification")
+	}
+	empty, err := HashDir(filepath.Join(src, "missing"))
+	if err != nil || empty == "" {
+		t.Fatalf("expected hash of missing directory, got %q %v", empty, err)
+	}
+}
+
+func TestUntar(t *testing.T) {
+	dst, err := ioutil.TempDir("", "test-untar")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dst)
+	files := map[string]string{
+		"chart/Chart.yaml":               "name: chart\n",
+		"chart/templates/configmap.yaml": "kind: ConfigMap\n",
+	}
+	if err = Untar(bytes.NewReader(testutil.Archive(t, files)), dst); err != nil {
+		t.Fatalf("failed to extract archive %v", err)
+	}
+	for name, content := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("failed to read extracted file %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Fatalf("expected %s to contain %q, got %q", name, content, data)
+		}
+	}
+}
+
+func TestUntarOutsideOfDestination(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-untar")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	dst := filepath.Join(root, "dst")
+	archive := testutil.Archive(t, map[string]string{"../evil.yaml": "evil"})
+	if err = Untar(bytes.NewReader(archive), dst); err != nil {
+		t.Fatalf("failed to extract archive %v", err)
+	}
+	if Exists(filepath.Join(root, "evil.yaml")) {
+		t.Fatalf("archive entry was extracted outside of the destination")
+	}
+}
@@ -1,11 +1,15 @@
 package fileutil
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 )
 
 func IsDir(name string) (isDir bool, err error) {
@@ -118,3 +122,47 @@ func CopyFile(src string, dst string) error {
 	}
 	return os.Chmod(dst, fi.Mode())
 }
+
+// HashDir calculates sha256 over relative paths, permissions and content
+// of all the files in the directory. Missing directory has empty hash
+func HashDir(dir string) (string, error) {
+	h := sha256.New()
+	if !Exists(dir) {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return "", err
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %o\n", filepath.ToSlash(rel), fi.Mode().Perm())
+		fd, err := os.Open(f)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, fd)
+		fd.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,129 @@
+package lock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/lwolf/kube-atlas/pkg/fileutil"
+)
+
+// FileName is the name of the lock file stored next to the config file
+const FileName = "kube-atlas.lock"
+
+// Entry records the chart vendored into the release package
+type Entry struct {
+	// Name is the name of the release
+	Name    string `json:"name"`
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+	// Repository is the URL of the repository chart was fetched from
+	Repository string `json:"repository,omitempty"`
+	// Ref and Path are the git reference and the directory of the git source
+	// from the config, Commit is the commit ref was resolved to
+	Ref    string `json:"ref,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Digest is the sha256 of the fetched chart archive
+	Digest string `json:"digest,omitempty"`
+	// TreeHash is the hash of the vendored chart directory, see fileutil.HashDir
+	TreeHash string `json:"treeHash"`
+	// Dependencies are the charts vendored into the charts directory of the chart
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// Dependency records the chart dependency vendored together with the chart
+type Dependency struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+}
+
+// File is the content of the lock file
+type File struct {
+	Releases []Entry `json:"releases"`
+
+	path string
+}
+
+// PathFor returns location of the lock file for the given config file
+func PathFor(configFile string) string {
+	if configFile == "" {
+		return FileName
+	}
+	return filepath.Join(filepath.Dir(configFile), FileName)
+}
+
+// Load reads the lock file, missing file results in empty lock
+func Load(path string) (*File, error) {
+	f := &File{path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// Get returns entry of the release or nil if release is not locked
+func (f *File) Get(name string) *Entry {
+	for i := range f.Releases {
+		if f.Releases[i].Name == name {
+			return &f.Releases[i]
+		}
+	}
+	return nil
+}
+
+// Set adds or replaces entry of the release
+func (f *File) Set(e Entry) {
+	if cur := f.Get(e.Name); cur != nil {
+		*cur = e
+		return
+	}
+	f.Releases = append(f.Releases, e)
+	sort.Slice(f.Releases, func(i, j int) bool {
+		return f.Releases[i].Name < f.Releases[j].Name
+	})
+}
+
+// Remove deletes entry of the release, returns false if it wasn't locked
+func (f *File) Remove(name string) bool {
+	for i := range f.Releases {
+		if f.Releases[i].Name == name {
+			f.Releases = append(f.Releases[:i], f.Releases[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the lock file back to its location
+func (f *File) Save() error {
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.path, data, 0644)
+}
+
+// Verify re-hashes vendored chart directory and compares it with the locked tree hash
+func (e *Entry) Verify(chartPath string) error {
+	hash, err := fileutil.HashDir(chartPath)
+	if err != nil {
+		return err
+	}
+	if hash != e.TreeHash {
+		return fmt.Errorf("chart directory %s doesn't match the lock file, expected tree hash %s, got %s", chartPath, e.TreeHash, hash)
+	}
+	return nil
+}
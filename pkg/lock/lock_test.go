@@ -0,0 +1,90 @@
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/pkg/fileutil"
+)
+
+func TestPathFor(t *testing.T) {
+	tests := map[string]string{
+		"":                         FileName,
+		"kube-atlas.yaml":          FileName,
+		"cluster/kube-atlas.yaml":  filepath.Join("cluster", FileName),
+		"/tmp/cluster/config.yaml": filepath.Join("/tmp/cluster", FileName),
+	}
+	for cfg, exp := range tests {
+		if got := PathFor(cfg); got != exp {
+			t.Fatalf("expected lock path for %q to be %s, got %s", cfg, exp, got)
+		}
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-lock")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, FileName)
+	lf, err := Load(path)
+	if err != nil {
+		t.Fatalf("missing lock file should be loaded as empty, got %v", err)
+	}
+	lf.Set(Entry{Name: "prometheus", Chart: "prometheus", Version: "8.11.4", TreeHash: "a"})
+	lf.Set(Entry{Name: "cert-manager", Chart: "cert-manager", Version: "v0.9.1", TreeHash: "b"})
+	lf.Set(Entry{Name: "prometheus", Chart: "prometheus", Version: "8.12.0", TreeHash: "c", Dependencies: []Dependency{{Name: "grafana", Version: "3.5.0", Repository: "@stable"}}})
+	if err = lf.Save(); err != nil {
+		t.Fatalf("failed to save lock file %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load lock file %v", err)
+	}
+	exp := []Entry{
+		{Name: "cert-manager", Chart: "cert-manager", Version: "v0.9.1", TreeHash: "b"},
+		{Name: "prometheus", Chart: "prometheus", Version: "8.12.0", TreeHash: "c", Dependencies: []Dependency{{Name: "grafana", Version: "3.5.0", Repository: "@stable"}}},
+	}
+	if diff := cmp.Diff(exp, loaded.Releases); diff != "" {
+		t.Fatalf("unexpected lock entries (-want +got):\n%s", diff)
+	}
+	if !loaded.Remove("cert-manager") || loaded.Remove("cert-manager") {
+		t.Fatalf("expected release to be removed only once")
+	}
+	if loaded.Get("cert-manager") != nil || loaded.Get("prometheus") == nil {
+		t.Fatalf("unexpected entries after removal %v", loaded.Releases)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-lock-chart")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatalf("failed to write chart file %v", err)
+	}
+	e := Entry{Name: "test"}
+	if err = e.Verify(dir); err == nil {
+		t.Fatalf("expected verification to fail for empty tree hash")
+	}
+	e.TreeHash, err = fileutil.HashDir(dir)
+	if err != nil {
+		t.Fatalf("failed to hash chart directory %v", err)
+	}
+	if err = e.Verify(dir); err != nil {
+		t.Fatalf("expected verification to succeed, got %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "values.yaml"), []byte("replicas: 2\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file %v", err)
+	}
+	if err = e.Verify(dir); err == nil {
+		t.Fatalf("expected verification to fail after chart was modified")
+	}
+}
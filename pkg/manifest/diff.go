@@ -0,0 +1,104 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Key identifies the object in the release
+type Key struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+func (k Key) String() string {
+	if k.Namespace == "" {
+		return fmt.Sprintf("%s/%s %s", k.APIVersion, k.Kind, k.Name)
+	}
+	return fmt.Sprintf("%s/%s %s/%s", k.APIVersion, k.Kind, k.Namespace, k.Name)
+}
+
+func (o *Object) Key() Key {
+	return Key{APIVersion: o.APIVersion(), Kind: o.Kind(), Namespace: o.Namespace(), Name: o.Name()}
+}
+
+type ChangeType string
+
+const (
+	Added   ChangeType = "added"
+	Removed ChangeType = "removed"
+	Changed ChangeType = "changed"
+)
+
+// Change describes difference of a single object
+type Change struct {
+	Key  Key
+	Type ChangeType
+	// Diff is a unified diff of the object, set for the changed objects only
+	Diff string
+}
+
+// Diff compares objects by their content ignoring formatting and comments,
+// changes are sorted by the object key
+func Diff(old, new []*Object) ([]Change, error) {
+	oldByKey := byKey(old)
+	newByKey := byKey(new)
+	var changes []Change
+	for k, o := range oldByKey {
+		n, ok := newByKey[k]
+		if !ok {
+			changes = append(changes, Change{Key: k, Type: Removed})
+			continue
+		}
+		if reflect.DeepEqual(o.Content, n.Content) {
+			continue
+		}
+		diff, err := unifiedDiff(k, o, n)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, Change{Key: k, Type: Changed, Diff: diff})
+	}
+	for k := range newByKey {
+		if _, ok := oldByKey[k]; !ok {
+			changes = append(changes, Change{Key: k, Type: Added})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key.String() < changes[j].Key.String()
+	})
+	return changes, nil
+}
+
+func byKey(objs []*Object) map[Key]*Object {
+	m := map[Key]*Object{}
+	for _, o := range objs {
+		m[o.Key()] = o
+	}
+	return m
+}
+
+func unifiedDiff(k Key, old, new *Object) (string, error) {
+	// marshal both objects to get the same formatting and keys order
+	a, err := yaml.Marshal(old.Content)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(new.Content)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: "a/" + k.String(),
+		ToFile:   "b/" + k.String(),
+		Context:  3,
+	})
+}
@@ -0,0 +1,76 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Parse([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: removed
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: same
+data: {a: b}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  replicas: 1
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	new, err := Parse([]byte(`# formatting and comments are ignored
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: same
+data:
+  a: b
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: added
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	changes, err := Diff(old, new)
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, string(c.Type)+" "+c.Key.String())
+	}
+	exp := []string{
+		"changed apps/v1/Deployment default/app",
+		"removed v1/ConfigMap removed",
+		"added v1/Secret added",
+	}
+	if !cmp.Equal(exp, got) {
+		t.Fatalf("expected %v, but got %v", exp, got)
+	}
+	if !strings.Contains(changes[0].Diff, "-  replicas: 1\n+  replicas: 2\n") {
+		t.Fatalf("unexpected diff of the changed object:\n%s", changes[0].Diff)
+	}
+}
@@ -0,0 +1,235 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Object is a single kubernetes resource parsed from the rendered output
+type Object struct {
+	// Header holds comment lines preceding the document, e.g. `# Source: ...` written by helm
+	Header string
+	// Content is the decoded resource
+	Content map[string]interface{}
+
+	body     []byte
+	modified bool
+}
+
+func (o *Object) APIVersion() string {
+	return stringField(o.Content, "apiVersion")
+}
+
+func (o *Object) Kind() string {
+	return stringField(o.Content, "kind")
+}
+
+// Group returns API group of the object, empty for the core group
+func (o *Object) Group() string {
+	apiVersion := o.APIVersion()
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+	return ""
+}
+
+func (o *Object) Name() string {
+	return stringField(metadata(o.Content), "name")
+}
+
+func (o *Object) Namespace() string {
+	return stringField(metadata(o.Content), "namespace")
+}
+
+func (o *Object) Labels() map[string]string {
+	labels := map[string]string{}
+	if l, ok := metadata(o.Content)["labels"].(map[string]interface{}); ok {
+		for k, v := range l {
+			labels[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return labels
+}
+
+// SetContent replaces content of the object keeping the header
+func (o *Object) SetContent(content map[string]interface{}) error {
+	body, err := yaml.Marshal(content)
+	if err != nil {
+		return err
+	}
+	o.Content = content
+	o.body = body
+	o.modified = true
+	return nil
+}
+
+// Modified reports whether content of the object was changed after parsing
+func (o *Object) Modified() bool {
+	return o.modified
+}
+
+// Bytes returns the yaml document of the object including the header
+func (o *Object) Bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString(o.Header)
+	b.Write(o.body)
+	if len(o.body) > 0 && o.body[len(o.body)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Encode concatenates objects into multi-document yaml
+func Encode(objs []*Object) []byte {
+	var b bytes.Buffer
+	for _, o := range objs {
+		b.WriteString("---\n")
+		b.Write(o.Bytes())
+	}
+	return b.Bytes()
+}
+
+func metadata(content map[string]interface{}) map[string]interface{} {
+	if m, ok := content["metadata"].(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{}
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Parse splits multi-document yaml into objects,
+// documents without content (e.g. only comments) are skipped
+func Parse(data []byte) ([]*Object, error) {
+	var objs []*Object
+	for i, doc := range SplitDocuments(data) {
+		header, body := splitHeader(doc)
+		if len(bytes.TrimSpace(body)) == 0 {
+			continue
+		}
+		var content map[string]interface{}
+		if err := yaml.Unmarshal(body, &content); err != nil {
+			return nil, fmt.Errorf("failed to parse document %d: %v", i, err)
+		}
+		if content == nil {
+			continue
+		}
+		o := &Object{Header: string(header), Content: content, body: body}
+		if o.Kind() == "" || o.APIVersion() == "" {
+			return nil, fmt.Errorf("document %d is not a kubernetes object, apiVersion and kind are required", i)
+		}
+		objs = append(objs, o)
+	}
+	return objs, nil
+}
+
+// ParseFile reads all the objects from the file
+func ParseFile(name string) ([]*Object, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return objs, nil
+}
+
+// ParseDir reads all the objects from yaml and json files
+// found in the directory recursively, files are processed in lexical order
+func ParseDir(dir string) ([]*Object, error) {
+	files, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*Object
+	for _, f := range files {
+		fobjs, err := ParseFile(f)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, fobjs...)
+	}
+	return objs, nil
+}
+
+// IsManifestFile checks whether file extension is one of the supported manifest formats
+func IsManifestFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// Files returns sorted list of manifest files found in the directory recursively
+func Files(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && IsManifestFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// SplitDocuments splits multi-document yaml by the `---` separator
+func SplitDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	var cur bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" || strings.HasPrefix(line, "--- ") {
+			docs = append(docs, append([]byte(nil), cur.Bytes()...))
+			cur.Reset()
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteByte('\n')
+	}
+	docs = append(docs, cur.Bytes())
+	return docs
+}
+
+// splitHeader separates leading comments and blank lines from the document body
+func splitHeader(doc []byte) ([]byte, []byte) {
+	var offset int
+	for offset < len(doc) {
+		end := bytes.IndexByte(doc[offset:], '\n')
+		if end < 0 {
+			end = len(doc) - offset
+		} else {
+			end++
+		}
+		line := bytes.TrimSpace(doc[offset : offset+end])
+		if len(line) > 0 && line[0] != '#' {
+			break
+		}
+		offset += end
+	}
+	return doc[:offset], doc[offset:]
+}
@@ -0,0 +1,87 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const helmOutput = `---
+# Source: prometheus/templates/server-serviceaccount.yaml
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: prometheus-server
+  labels:
+    app: prometheus
+    component: server
+---
+# Source: prometheus/templates/empty.yaml
+
+---
+# Source: prometheus/templates/server-deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prometheus-server
+  namespace: monitoring
+  labels:
+    app: prometheus
+`
+
+func TestParse(t *testing.T) {
+	objs, err := Parse([]byte(helmOutput))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	var got []string
+	for _, o := range objs {
+		got = append(got, o.Kind()+"/"+o.Name())
+	}
+	exp := []string{"ServiceAccount/prometheus-server", "Deployment/prometheus-server"}
+	if !cmp.Equal(exp, got) {
+		t.Fatalf("expected to get following objects %v, but got %v", exp, got)
+	}
+	if objs[0].Header != "# Source: prometheus/templates/server-serviceaccount.yaml\n" {
+		t.Fatalf("unexpected header %q", objs[0].Header)
+	}
+	if objs[1].Group() != "apps" {
+		t.Fatalf("expected apps group, got %q", objs[1].Group())
+	}
+}
+
+func TestParseInvalidObject(t *testing.T) {
+	_, err := Parse([]byte("foo: bar\n"))
+	if err == nil {
+		t.Fatal("expected error for the document without kind")
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	objs, err := Parse([]byte(helmOutput))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	tests := []struct {
+		name     string
+		selector Selector
+		exp      []bool
+	}{
+		{"empty", Selector{}, []bool{true, true}},
+		{"kind", Selector{Kind: "deployment"}, []bool{false, true}},
+		{"apiVersion", Selector{APIVersion: "apps/*"}, []bool{false, true}},
+		{"name pattern", Selector{Name: "prometheus-*"}, []bool{true, true}},
+		{"namespace", Selector{Namespace: "monitoring"}, []bool{false, true}},
+		{"labels", Selector{Labels: map[string]string{"component": "server"}}, []bool{true, false}},
+		{"labels mismatch", Selector{Labels: map[string]string{"app": "grafana"}}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		var got []bool
+		for _, o := range objs {
+			got = append(got, tt.selector.Matches(o))
+		}
+		if !cmp.Equal(tt.exp, got) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.exp, got)
+		}
+	}
+}
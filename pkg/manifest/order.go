@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"sort"
+)
+
+// OrderedGroup is a set of objects sharing the same apply order
+type OrderedGroup struct {
+	// Index is the position of the group in the apply order, starting from 1
+	Index   int
+	Name    string
+	Objects []*Object
+}
+
+type orderClass struct {
+	name  string
+	kinds []string
+}
+
+// workloadsClass collects all the kinds not listed in the other classes
+const workloadsClass = "workloads"
+
+// applyOrder defines groups of resources in the order they should be applied
+var applyOrder = []orderClass{
+	{"namespaces", []string{"Namespace", "ResourceQuota", "LimitRange"}},
+	{"crds", []string{"CustomResourceDefinition"}},
+	{"rbac", []string{"PodSecurityPolicy", "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"}},
+	{"config", []string{"Secret", "ConfigMap"}},
+	{workloadsClass, nil},
+	{"webhooks", []string{"APIService", "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"}},
+}
+
+// kindOrder defines the order of kinds inside of the workloads group, same as helm install order
+var kindOrder = []string{
+	"PriorityClass",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+}
+
+// Order splits objects into groups following the apply order,
+// e.g. namespaces first, webhooks last. Empty groups are omitted,
+// objects inside of the group are sorted by kind keeping the original order otherwise
+func Order(objs []*Object) []OrderedGroup {
+	classIndex := map[string]int{}
+	kindIndex := map[string]int{}
+	for i, c := range applyOrder {
+		for j, k := range c.kinds {
+			classIndex[k] = i
+			kindIndex[k] = j
+		}
+	}
+	for j, k := range kindOrder {
+		kindIndex[k] = j
+	}
+	var workloads int
+	for i, c := range applyOrder {
+		if c.name == workloadsClass {
+			workloads = i
+		}
+	}
+	buckets := make([][]*Object, len(applyOrder))
+	for _, o := range objs {
+		i, ok := classIndex[o.Kind()]
+		if !ok {
+			i = workloads
+		}
+		buckets[i] = append(buckets[i], o)
+	}
+	var groups []OrderedGroup
+	for i, bucket := range buckets {
+		if len(bucket) == 0 {
+			continue
+		}
+		sort.SliceStable(bucket, func(a, b int) bool {
+			return kindPosition(kindIndex, bucket[a].Kind()) < kindPosition(kindIndex, bucket[b].Kind())
+		})
+		groups = append(groups, OrderedGroup{Index: i + 1, Name: applyOrder[i].name, Objects: bucket})
+	}
+	return groups
+}
+
+func kindPosition(index map[string]int, kind string) int {
+	if i, ok := index[kind]; ok {
+		return i
+	}
+	// unknown kinds, e.g. custom resources go last
+	return len(kindOrder)
+}
@@ -0,0 +1,76 @@
+package manifest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const unorderedOutput = `
+apiVersion: admissionregistration.k8s.io/v1beta1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: injector
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: example.com/v1
+kind: Foo
+metadata:
+  name: foo
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: foos.example.com
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: app
+`
+
+func TestOrder(t *testing.T) {
+	objs, err := Parse([]byte(unorderedOutput))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	var got []string
+	for _, g := range Order(objs) {
+		for _, o := range g.Objects {
+			got = append(got, fmt.Sprintf("%03d-%s/%s", g.Index, g.Name, o.Kind()))
+		}
+	}
+	exp := []string{
+		"001-namespaces/Namespace",
+		"002-crds/CustomResourceDefinition",
+		"003-rbac/ServiceAccount",
+		"003-rbac/RoleBinding",
+		"005-workloads/Service",
+		"005-workloads/Deployment",
+		"005-workloads/Foo",
+		"006-webhooks/MutatingWebhookConfiguration",
+	}
+	if !cmp.Equal(exp, got) {
+		t.Fatalf("expected %v, but got %v", exp, got)
+	}
+}
@@ -0,0 +1,53 @@
+package manifest
+
+import (
+	"path"
+	"strings"
+)
+
+// Selector matches objects by their type, name, namespace and labels.
+// Empty fields match everything, name, namespace and apiVersion
+// support shell patterns, e.g. `prometheus-*`
+type Selector struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Name       string            `yaml:"name"`
+	Namespace  string            `yaml:"namespace"`
+	Labels     map[string]string `yaml:"labels"`
+}
+
+// Matches checks whether object satisfies all the conditions of the selector
+func (s *Selector) Matches(o *Object) bool {
+	if s.Kind != "" && !strings.EqualFold(s.Kind, o.Kind()) {
+		return false
+	}
+	if !matchPattern(s.APIVersion, o.APIVersion()) {
+		return false
+	}
+	if !matchPattern(s.Name, o.Name()) {
+		return false
+	}
+	if !matchPattern(s.Namespace, o.Namespace()) {
+		return false
+	}
+	if len(s.Labels) > 0 {
+		labels := o.Labels()
+		for k, v := range s.Labels {
+			if lv, ok := labels[k]; !ok || lv != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, value)
+	if err != nil {
+		return pattern == value
+	}
+	return ok
+}
@@ -0,0 +1,224 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Scheme is the prefix of the chart references stored in OCI registry
+	Scheme = "oci://"
+
+	// ManifestMediaType is the media type of the OCI image manifest
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// ChartLayerMediaType is the media type of the layer with the chart archive
+	ChartLayerMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	// legacyChartLayerMediaType was used by helm before 3.7
+	legacyChartLayerMediaType = "application/tar+gzip"
+)
+
+// IsReference returns true if chart is the OCI reference
+func IsReference(chart string) bool {
+	return strings.HasPrefix(chart, Scheme)
+}
+
+// Reference is the chart location in the registry, e.g. oci://registry.local/charts/demo
+type Reference struct {
+	// Registry is the host of the registry, optionally with port
+	Registry string
+	// Repository is the path of the chart in the registry
+	Repository string
+}
+
+// ParseReference parses oci://registry/path/chart reference
+func ParseReference(ref string) (*Reference, error) {
+	if !IsReference(ref) {
+		return nil, fmt.Errorf("chart reference %s should start with %s", ref, Scheme)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(ref, Scheme), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.Trim(parts[1], "/") == "" {
+		return nil, fmt.Errorf("chart reference %s should be in form %sregistry/path/chart", ref, Scheme)
+	}
+	return &Reference{Registry: parts[0], Repository: strings.Trim(parts[1], "/")}, nil
+}
+
+func (r *Reference) String() string {
+	return Scheme + r.Registry + "/" + r.Repository
+}
+
+// Client pulls charts from the registry implementing the distribution API v2
+type Client struct {
+	username string
+	password string
+	http     *http.Client
+	// token is the bearer token obtained during the last auth challenge
+	token string
+}
+
+// NewClient creates registry client, credentials are optional
+func NewClient(username, password string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{username: username, password: password, http: httpClient}
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// Pull writes chart archive of the version to w and returns its digest
+func (c *Client) Pull(ref *Reference, version string, w io.Writer) (string, error) {
+	if version == "" {
+		return "", fmt.Errorf("version of the chart %s is required", ref)
+	}
+	// "+" is not allowed in tags, helm replaces it with "_"
+	tag := strings.Replace(version, "+", "_", -1)
+	data, err := c.get(ref, fmt.Sprintf("manifests/%s", tag), ManifestMediaType)
+	if err != nil {
+		return "", fmt.Errorf("failed to get manifest of the chart %s:%s: %v", ref, tag, err)
+	}
+	var m manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return "", fmt.Errorf("failed to parse manifest of the chart %s:%s: %v", ref, tag, err)
+	}
+	var layer *descriptor
+	for i, l := range m.Layers {
+		if l.MediaType == ChartLayerMediaType || l.MediaType == legacyChartLayerMediaType {
+			layer = &m.Layers[i]
+			break
+		}
+	}
+	if layer == nil {
+		return "", fmt.Errorf("manifest of %s:%s has no chart layer", ref, tag)
+	}
+	blob, err := c.get(ref, "blobs/"+layer.Digest, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get chart layer of %s:%s: %v", ref, tag, err)
+	}
+	sum := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if digest != layer.Digest {
+		return "", fmt.Errorf("digest of the chart layer %s doesn't match the manifest %s", digest, layer.Digest)
+	}
+	_, err = w.Write(blob)
+	return digest, err
+}
+
+// get requests the path relative to the repository, answering auth challenge if needed
+func (c *Client) get(ref *Reference, path, accept string) ([]byte, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.Registry, ref.Repository, path)
+	resp, err := c.do(u, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err = c.authorize(challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(u, accept); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from %s: %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *Client) do(u, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "" || c.password != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.http.Do(req)
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authorize obtains bearer token described by the challenge,
+// basic challenge is answered by the credentials on the next request
+func (c *Client) authorize(challenge string) error {
+	if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+		if c.username == "" && c.password == "" {
+			return fmt.Errorf("registry requires credentials")
+		}
+		return fmt.Errorf("registry rejected provided credentials")
+	}
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer") {
+		return fmt.Errorf("unsupported auth challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, m := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid realm in the auth challenge %q", challenge)
+	}
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if v := params[k]; v != "" {
+			q.Set(k, v)
+		}
+	}
+	realm.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return fmt.Errorf("registry returned empty token")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	ref, err := ParseReference("oci://registry.local:5000/charts/demo/")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if ref.Registry != "registry.local:5000" || ref.Repository != "charts/demo" {
+		t.Fatalf("unexpected reference %+v", ref)
+	}
+	if ref.String() != "oci://registry.local:5000/charts/demo" {
+		t.Fatalf("unexpected reference string %s", ref)
+	}
+	for _, invalid := range []string{"stable/demo", "oci://", "oci://registry.local", "oci://registry.local/"} {
+		if _, err = ParseReference(invalid); err == nil {
+			t.Fatalf("expected error for reference %q", invalid)
+		}
+	}
+}
+
+// registry is in-process registry serving single chart with the token auth
+type registry struct {
+	chart    []byte
+	digest   string
+	manifest []byte
+}
+
+func newRegistry(t *testing.T, chart []byte) *registry {
+	sum := sha256.Sum256(chart)
+	r := &registry{chart: chart, digest: "sha256:" + hex.EncodeToString(sum[:])}
+	m := manifest{
+		SchemaVersion: 2,
+		Config:        descriptor{MediaType: "application/vnd.cncf.helm.config.v1+json", Digest: "sha256:0", Size: 2},
+		Layers:        []descriptor{{MediaType: ChartLayerMediaType, Digest: r.digest, Size: int64(len(chart))}},
+	}
+	var err error
+	if r.manifest, err = json.Marshal(m); err != nil {
+		t.Fatalf("failed to marshal manifest %v", err)
+	}
+	return r
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if u, p, ok := req.BasicAuth(); !ok || u != "user" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != "repository:charts/demo:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token": "registry-token"}`))
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer registry-token" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="registry",scope="repository:charts/demo:pull"`, req.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch req.URL.Path {
+	case "/v2/charts/demo/manifests/1.2.0_build.1":
+		if req.Header.Get("Accept") != ManifestMediaType {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", ManifestMediaType)
+		_, _ = w.Write(r.manifest)
+	case "/v2/charts/demo/blobs/" + r.digest:
+		_, _ = w.Write(r.chart)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPull(t *testing.T) {
+	chart := []byte("chart archive content")
+	reg := newRegistry(t, chart)
+	srv := httptest.NewTLSServer(reg)
+	defer srv.Close()
+	ref, err := ParseReference("oci://" + strings.TrimPrefix(srv.URL, "https://") + "/charts/demo")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var buf bytes.Buffer
+	digest, err := NewClient("user", "secret", srv.Client()).Pull(ref, "1.2.0+build.1", &buf)
+	if err != nil {
+		t.Fatalf("failed to pull chart %v", err)
+	}
+	if digest != reg.digest || !bytes.Equal(buf.Bytes(), chart) {
+		t.Fatalf("unexpected chart %q with digest %s", buf.Bytes(), digest)
+	}
+
+	if _, err = NewClient("user", "wrong", srv.Client()).Pull(ref, "1.2.0+build.1", &buf); err == nil {
+		t.Fatalf("expected error for wrong credentials")
+	}
+	if _, err = NewClient("user", "secret", srv.Client()).Pull(ref, "2.0.0", &buf); err == nil {
+		t.Fatalf("expected error for missing version")
+	}
+	if _, err = NewClient("user", "secret", srv.Client()).Pull(ref, "", &buf); err == nil {
+		t.Fatalf("expected error for empty version")
+	}
+}
@@ -0,0 +1,216 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/ghodss/yaml"
+
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+)
+
+const (
+	// TypeStrategic is a kubernetes strategic merge patch
+	TypeStrategic = "strategic"
+	// TypeJSON is a RFC 6902 JSON patch
+	TypeJSON = "json"
+	// TypeMerge is a RFC 7386 JSON merge patch
+	TypeMerge = "merge"
+)
+
+// Patch is a single modification of the rendered resources.
+//
+// Patch file could contain multiple yaml documents, each of them is either
+// a partial kubernetes resource (strategic merge patch targeting the resource
+// with the same kind, name and namespace) or an explicit patch definition:
+//
+//	type: json # json, merge or strategic
+//	target:
+//	  kind: Deployment
+//	  name: prometheus-server
+//	patch:
+//	  - op: replace
+//	    path: /spec/replicas
+//	    value: 2
+//
+// type could be omitted, a list of operations is a json patch, an object is a strategic merge patch
+type Patch struct {
+	// File is the source of the patch
+	File   string
+	Type   string
+	Target manifest.Selector
+	// Content is the body of the patch, list of operations for the json patch
+	Content interface{}
+}
+
+type patchDefinition struct {
+	Type    string            `json:"type"`
+	Target  manifest.Selector `json:"target"`
+	Content interface{}       `json:"patch"`
+}
+
+// LoadDir reads all the patches from yaml and json files in the directory,
+// files are processed in lexical order. Missing directory means no patches
+func LoadDir(dir string) ([]Patch, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	files, err := manifest.Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	var patches []Patch
+	for _, f := range files {
+		fpatches, err := LoadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, fpatches...)
+	}
+	return patches, nil
+}
+
+// LoadFile reads all the patches from the file
+func LoadFile(name string) ([]Patch, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var patches []Patch
+	for i, doc := range manifest.SplitDocuments(data) {
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		p, err := parse(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: document %d: %v", name, i, err)
+		}
+		if p == nil {
+			continue
+		}
+		p.File = name
+		patches = append(patches, *p)
+	}
+	return patches, nil
+}
+
+func parse(doc []byte) (*Patch, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(doc, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	if _, ok := raw["patch"]; ok {
+		var def patchDefinition
+		if err := yaml.Unmarshal(doc, &def); err != nil {
+			return nil, err
+		}
+		p := &Patch{Type: def.Type, Target: def.Target, Content: def.Content}
+		if p.Type == "" {
+			p.Type = TypeStrategic
+			if _, ok := def.Content.([]interface{}); ok {
+				p.Type = TypeJSON
+			}
+		}
+		return p, p.validate()
+	}
+	// partial resource is a strategic merge patch of the resource with the same identity
+	o := &manifest.Object{Content: raw}
+	if o.Kind() == "" || o.Name() == "" {
+		return nil, fmt.Errorf("patch should be either a resource with kind and metadata.name or define `target` and `patch`")
+	}
+	p := &Patch{
+		Type:    TypeStrategic,
+		Target:  manifest.Selector{Kind: o.Kind(), Name: o.Name(), Namespace: o.Namespace()},
+		Content: raw,
+	}
+	return p, nil
+}
+
+func (p *Patch) validate() error {
+	switch p.Type {
+	case TypeJSON:
+		if _, ok := p.Content.([]interface{}); !ok {
+			return fmt.Errorf("json patch should be a list of operations")
+		}
+	case TypeMerge, TypeStrategic:
+		if _, ok := p.Content.(map[string]interface{}); !ok {
+			return fmt.Errorf("%s patch should be an object", p.Type)
+		}
+	default:
+		return fmt.Errorf("unknown patch type %q", p.Type)
+	}
+	return nil
+}
+
+// Apply applies patches to every object matching its target.
+// Patch that doesn't match any object is an error, most likely
+// the upstream chart has changed and the patch is outdated
+func Apply(objs []*manifest.Object, patches []Patch) error {
+	for _, p := range patches {
+		var matched bool
+		for _, o := range objs {
+			if !p.Target.Matches(o) {
+				continue
+			}
+			matched = true
+			content, err := p.apply(o.Content)
+			if err != nil {
+				return fmt.Errorf("%s: failed to patch %s/%s: %v", p.File, o.Kind(), o.Name(), err)
+			}
+			if err = o.SetContent(content); err != nil {
+				return err
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: %s patch did not match any resource", p.File, p.Type)
+		}
+	}
+	return nil
+}
+
+func (p *Patch) apply(content map[string]interface{}) (map[string]interface{}, error) {
+	if p.Type == TypeStrategic {
+		return strategicMerge(deepCopy(content), p.Content.(map[string]interface{})), nil
+	}
+	orig, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := json.Marshal(p.Content)
+	if err != nil {
+		return nil, err
+	}
+	var patched []byte
+	switch p.Type {
+	case TypeMerge:
+		patched, err = jsonpatch.MergePatch(orig, patch)
+	case TypeJSON:
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			patched, err = ops.Apply(orig)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err = json.Unmarshal(patched, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func deepCopy(content map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(content)
+	var result map[string]interface{}
+	_ = json.Unmarshal(data, &result)
+	return result
+}
@@ -0,0 +1,230 @@
+package patch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+)
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:1.0
+          env:
+            - name: A
+              value: a
+            - name: B
+              value: b
+        - name: sidecar
+          image: sidecar:1.0
+`
+
+func loadPatches(t *testing.T, content string) []Patch {
+	dir, err := ioutil.TempDir("", "test-patches")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "patch.yaml"), []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("failed to write patch: %v", err)
+	}
+	patches, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to load patches: %v", err)
+	}
+	return patches
+}
+
+func applyToDeployment(t *testing.T, patches string) *manifest.Object {
+	objs, err := manifest.Parse([]byte(deployment))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if err = Apply(objs, loadPatches(t, patches)); err != nil {
+		t.Fatalf("failed to apply patches: %v", err)
+	}
+	return objs[0]
+}
+
+func containers(o *manifest.Object) []interface{} {
+	spec := o.Content["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"]
+	return spec.(map[string]interface{})["containers"].([]interface{})
+}
+
+func TestStrategicMergePatch(t *testing.T) {
+	o := applyToDeployment(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:2.0
+          env:
+            - name: B
+              $patch: delete
+            - name: C
+              value: c
+        - name: sidecar
+          $patch: delete
+`)
+	if !o.Modified() {
+		t.Fatal("expected object to be modified")
+	}
+	c := containers(o)
+	if len(c) != 1 {
+		t.Fatalf("expected sidecar to be removed, got %v", c)
+	}
+	app := c[0].(map[string]interface{})
+	if app["image"] != "app:2.0" {
+		t.Fatalf("expected image to be updated, got %v", app["image"])
+	}
+	var env []string
+	for _, e := range app["env"].([]interface{}) {
+		env = append(env, e.(map[string]interface{})["name"].(string))
+	}
+	if !cmp.Equal([]string{"A", "C"}, env) {
+		t.Fatalf("unexpected env after patch %v", env)
+	}
+}
+
+func TestStrategicMergePatchNewItems(t *testing.T) {
+	o := applyToDeployment(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: proxy
+          image: proxy:1.0
+          env:
+            - name: A
+              $patch: delete
+            - name: B
+              value: b
+          resources:
+            $patch: replace
+            limits:
+              cpu: 100m
+      volumes:
+        - name: data
+          emptyDir:
+            $patch: replace
+`)
+	data, err := yaml.Marshal(o.Content)
+	if err != nil {
+		t.Fatalf("failed to marshal object: %v", err)
+	}
+	if strings.Contains(string(data), directive) {
+		t.Fatalf("expected patch directives to be removed from the new items:\n%s", data)
+	}
+	c := containers(o)
+	if len(c) != 3 {
+		t.Fatalf("expected proxy to be added, got %v", c)
+	}
+	proxy := c[2].(map[string]interface{})
+	exp := map[string]interface{}{
+		"name":      "proxy",
+		"image":     "proxy:1.0",
+		"env":       []interface{}{map[string]interface{}{"name": "B", "value": "b"}},
+		"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "100m"}},
+	}
+	if diff := cmp.Diff(exp, proxy); diff != "" {
+		t.Fatalf("unexpected container (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	o := applyToDeployment(t, `target:
+  kind: Deployment
+  name: app
+patch:
+  - op: replace
+    path: /spec/replicas
+    value: 3
+  - op: add
+    path: /metadata/labels/team
+    value: infra
+`)
+	if o.Content["spec"].(map[string]interface{})["replicas"] != float64(3) {
+		t.Fatalf("expected replicas to be replaced, got %v", o.Content["spec"])
+	}
+	if o.Labels()["team"] != "infra" {
+		t.Fatalf("expected label to be added, got %v", o.Labels())
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	o := applyToDeployment(t, `type: merge
+target:
+  labels:
+    app: app
+patch:
+  metadata:
+    labels:
+      app: null
+  spec:
+    template:
+      spec:
+        containers:
+          - name: only
+            image: only:1.0
+`)
+	if _, ok := o.Labels()["app"]; ok {
+		t.Fatalf("expected label to be removed, got %v", o.Labels())
+	}
+	// merge patch replaces lists entirely
+	if len(containers(o)) != 1 {
+		t.Fatalf("expected containers to be replaced, got %v", containers(o))
+	}
+}
+
+func TestPatchWithoutMatch(t *testing.T) {
+	objs, err := manifest.Parse([]byte(deployment))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	patches := loadPatches(t, `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  type: NodePort
+`)
+	if err = Apply(objs, patches); err == nil {
+		t.Fatal("expected error for the patch without matching resources")
+	}
+}
+
+func TestInvalidPatch(t *testing.T) {
+	_, err := parse([]byte(`type: json
+target:
+  kind: Deployment
+patch:
+  spec: {}
+`))
+	if err == nil {
+		t.Fatal("expected error for json patch defined as object")
+	}
+}
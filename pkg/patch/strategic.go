@@ -0,0 +1,127 @@
+package patch
+
+import "fmt"
+
+const directive = "$patch"
+
+// mergeKeys are the fields used to identify list items, the first key present
+// in all the items of the patch list wins. This covers the most common
+// kubernetes lists, e.g. containers, env, volumes, volumeMounts and ports
+var mergeKeys = []string{"mountPath", "containerPort", "port", "name", "ip"}
+
+// strategicMerge is a simplified version of the kubernetes strategic merge patch
+// which doesn't require resource schema. Maps are merged recursively, `null` removes
+// the field, lists of objects are merged by the detected merge key, items with
+// `$patch: delete` are removed, all other lists are replaced
+func strategicMerge(orig, patch map[string]interface{}) map[string]interface{} {
+	if patch[directive] == "replace" {
+		return withoutDirective(patch)
+	}
+	for k, pv := range patch {
+		if k == directive {
+			continue
+		}
+		if pv == nil {
+			delete(orig, k)
+			continue
+		}
+		switch pvt := pv.(type) {
+		case map[string]interface{}:
+			if om, ok := orig[k].(map[string]interface{}); ok {
+				orig[k] = strategicMerge(om, pvt)
+			} else {
+				orig[k] = withoutDirective(pvt)
+			}
+		case []interface{}:
+			if ol, ok := orig[k].([]interface{}); ok {
+				orig[k] = mergeList(ol, pvt)
+			} else {
+				orig[k] = withoutDirectives(pvt)
+			}
+		default:
+			orig[k] = pv
+		}
+	}
+	return orig
+}
+
+func mergeList(orig, patch []interface{}) []interface{} {
+	key := mergeKey(patch)
+	if key == "" {
+		return withoutDirectives(patch).([]interface{})
+	}
+	result := append([]interface{}{}, orig...)
+	for _, p := range patch {
+		pm := p.(map[string]interface{})
+		idx := -1
+		for i, o := range result {
+			if om, ok := o.(map[string]interface{}); ok && fmt.Sprint(om[key]) == fmt.Sprint(pm[key]) {
+				idx = i
+				break
+			}
+		}
+		switch {
+		case pm[directive] == "delete":
+			if idx >= 0 {
+				result = append(result[:idx], result[idx+1:]...)
+			}
+		case idx >= 0:
+			result[idx] = strategicMerge(result[idx].(map[string]interface{}), pm)
+		default:
+			result = append(result, withoutDirective(pm))
+		}
+	}
+	return result
+}
+
+func mergeKey(patch []interface{}) string {
+	if len(patch) == 0 {
+		return ""
+	}
+	for _, key := range mergeKeys {
+		found := true
+		for _, p := range patch {
+			pm, ok := p.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			if _, ok := pm[key]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return key
+		}
+	}
+	return ""
+}
+
+// withoutDirective removes patch directives from the map and all the nested
+// maps and lists, items marked with `$patch: delete` are dropped
+func withoutDirective(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != directive {
+			result[k] = withoutDirectives(v)
+		}
+	}
+	return result
+}
+
+func withoutDirectives(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		return withoutDirective(vt)
+	case []interface{}:
+		result := make([]interface{}, 0, len(vt))
+		for _, item := range vt {
+			if im, ok := item.(map[string]interface{}); ok && im[directive] == "delete" {
+				continue
+			}
+			result = append(result, withoutDirectives(item))
+		}
+		return result
+	}
+	return v
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	exec_kustomize "github.com/lwolf/kube-atlas/pkg/exec/kustomize"
+	"github.com/lwolf/kube-atlas/pkg/fileutil"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+// releaseHashFile is stored in the release directory after successful render
+const releaseHashFile = ".kube-atlas.sum"
+
+// effectiveSpec is the part of the config affecting rendered output of the release
+type effectiveSpec struct {
+	Release             state.ReleaseSpec
+	ClusterName         string
+	KubeVersion         string
+	RenderMode          string
+	Rules               []state.RenderRule
+	ReleasePathTemplate string
+}
+
+// ToolVersions returns versions of helm and kustomize, both affect rendered output
+func ToolVersions() string {
+	helmVersion, err := exec_helm.NewExecHelm(&log.Logger).Version()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get helm version")
+	}
+	kustomizeVersion, err := exec_kustomize.NewExecKustomize(&log.Logger).Version()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get kustomize version")
+	}
+	return fmt.Sprintf("helm=%s\nkustomize=%s", helmVersion, kustomizeVersion)
+}
+
+// ReleaseHash calculates hash over all the inputs of the release:
+// chart, values, manifests and patches directories, effective spec and tool versions
+func ReleaseHash(r *state.ReleaseSpec, s *state.ClusterSpec, tools string) (string, error) {
+	h := sha256.New()
+	spec, err := json.Marshal(effectiveSpec{
+		Release:             *r,
+		ClusterName:         r.GetClusterName(&s.Defaults),
+		KubeVersion:         r.GetKubeVersion(&s.Defaults),
+		RenderMode:          r.GetRenderMode(&s.Defaults),
+		Rules:               r.GetRules(&s.Defaults),
+		ReleasePathTemplate: s.Defaults.GetReleasePathTemplate(),
+	})
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "spec=%s\n%s\n", spec, tools)
+	for _, getPath := range []func(*state.DefaultConfig) (string, error){
+		r.GetChartPath,
+		r.GetValuesPath,
+		r.GetManifestsPath,
+		r.GetPatchesPath,
+	} {
+		p, err := getPath(&s.Defaults)
+		if err != nil {
+			return "", err
+		}
+		dirHash, err := fileutil.HashDir(p)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s=%s\n", filepath.Base(p), dirHash)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// IsUpToDate checks whether hash stored in the release directory matches the current one
+func IsUpToDate(r *state.ReleaseSpec, s *state.ClusterSpec, hash string) bool {
+	dstPath, err := r.GetReleasePath(&s.Defaults)
+	if err != nil {
+		return false
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(dstPath, releaseHashFile))
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(stored)) == hash
+}
+
+// WriteReleaseHash stores hash of the release inputs in the release directory
+func WriteReleaseHash(r *state.ReleaseSpec, s *state.ClusterSpec, hash string) error {
+	dstPath, err := r.GetReleasePath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dstPath, releaseHashFile), []byte(hash+"\n"), 0644)
+}
+
+// RemoveReleaseHash removes hash stored in the release directory,
+// release is rendered on the next run regardless of its inputs
+func RemoveReleaseHash(r *state.ReleaseSpec, s *state.ClusterSpec) error {
+	dstPath, err := r.GetReleasePath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(dstPath, releaseHashFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+func TestReleaseHash(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-cache")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	s := &state.ClusterSpec{Defaults: state.DefaultConfig{
+		ClusterName: "dev",
+		SourcePath:  filepath.Join(root, "apps"),
+		ReleasePath: filepath.Join(root, "releases"),
+	}}
+	r := &state.ReleaseSpec{Name: "app", Namespace: "default", Chart: "stable/app", Version: "1.0.0"}
+	if err = r.InitDirs(&s.Defaults); err != nil {
+		t.Fatalf("failed to create package directories %v", err)
+	}
+	writeFile := func(getPath func(*state.DefaultConfig) (string, error), name, content string) {
+		dir, err := getPath(&s.Defaults)
+		if err != nil {
+			t.Fatalf("failed to get package directory %v", err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file %v", err)
+		}
+	}
+	writeFile(r.GetChartPath, "Chart.yaml", "name: app\nversion: 1.0.0\n")
+	writeFile(r.GetValuesPath, "values.yaml", "replicas: 1\n")
+
+	hash := func() string {
+		h, err := ReleaseHash(r, s, "helm=v2.14.0")
+		if err != nil {
+			t.Fatalf("failed to calculate hash %v", err)
+		}
+		return h
+	}
+	seen := map[string]string{}
+	check := func(change string) {
+		h := hash()
+		if prev, ok := seen[h]; ok {
+			t.Fatalf("expected %s to change the hash, it is the same as after %s", change, prev)
+		}
+		seen[h] = change
+	}
+	check("initial")
+	if hash() != hash() {
+		t.Fatalf("expected hash to be stable")
+	}
+	writeFile(r.GetValuesPath, "values.yaml", "replicas: 2\n")
+	check("values")
+	writeFile(r.GetPatchesPath, "patch.yaml", "kind: Deployment\n")
+	check("patches")
+	r.Version = "1.1.0"
+	check("release spec")
+	s.Defaults.KubeVersion = "1.15.0"
+	check("kube version")
+	if h, _ := ReleaseHash(r, s, "helm=v2.15.0"); seen[h] != "" {
+		t.Fatalf("expected tool versions to change the hash")
+	}
+}
+
+func TestIsUpToDate(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-cache")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	s := &state.ClusterSpec{Defaults: state.DefaultConfig{
+		ClusterName: "dev",
+		SourcePath:  filepath.Join(root, "apps"),
+		ReleasePath: filepath.Join(root, "releases"),
+	}}
+	r := &state.ReleaseSpec{Name: "app", Namespace: "default"}
+	if IsUpToDate(r, s, "abc") {
+		t.Fatalf("expected release without release directory to be rendered")
+	}
+	dstPath, err := r.GetReleasePath(&s.Defaults)
+	if err != nil {
+		t.Fatalf("failed to get release path %v", err)
+	}
+	if err = os.MkdirAll(dstPath, 0755); err != nil {
+		t.Fatalf("failed to create release directory %v", err)
+	}
+	if IsUpToDate(r, s, "abc") {
+		t.Fatalf("expected release without stored hash to be rendered")
+	}
+	if err = WriteReleaseHash(r, s, "abc"); err != nil {
+		t.Fatalf("failed to write hash %v", err)
+	}
+	if !IsUpToDate(r, s, "abc") {
+		t.Fatalf("expected release with matching hash to be skipped")
+	}
+	if IsUpToDate(r, s, "def") {
+		t.Fatalf("expected release with changed inputs to be rendered")
+	}
+	if err = RemoveReleaseHash(r, s); err != nil {
+		t.Fatalf("failed to remove hash %v", err)
+	}
+	if IsUpToDate(r, s, "abc") {
+		t.Fatalf("expected release without stored hash to be rendered")
+	}
+	if err = WriteReleaseHash(r, s, "abc"); err != nil {
+		t.Fatalf("failed to write hash %v", err)
+	}
+	if err = os.RemoveAll(dstPath); err != nil {
+		t.Fatalf("failed to remove release directory %v", err)
+	}
+	if IsUpToDate(r, s, "abc") {
+		t.Fatalf("expected deleted release directory to force the render")
+	}
+	if err = RemoveReleaseHash(r, s); err != nil {
+		t.Fatalf("expected missing hash to be ignored, got %v", err)
+	}
+}
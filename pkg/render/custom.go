@@ -0,0 +1,138 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+type ruleTemplateVars struct {
+	ReleaseName      string
+	ReleaseNamespace string
+	APIVersion       string
+	Group            string
+	Kind             string
+	Name             string
+	Namespace        string
+}
+
+type compiledRule struct {
+	rule   state.RenderRule
+	output *template.Template
+}
+
+var ruleFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+func compileRules(rules []state.RenderRule) ([]compiledRule, error) {
+	var compiled []compiledRule
+	for i, r := range rules {
+		if r.Output == "" {
+			return nil, fmt.Errorf("rule %d has empty output", i)
+		}
+		tmpl, err := template.New(fmt.Sprintf("rule-%d", i)).Funcs(ruleFuncs).Parse(r.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse output of rule %d: %v", i, err)
+		}
+		compiled = append(compiled, compiledRule{rule: r, output: tmpl})
+	}
+	return compiled, nil
+}
+
+// renderCustom routes every object found in srcDir to the file
+// defined by the first matching rule. Objects without matching rule
+// are written to the default `<release>.yaml` file
+func renderCustom(release *state.ReleaseSpec, s *state.ClusterSpec, srcDir, dstPath string) error {
+	rlog := log.With().Str("release", release.Name).Logger()
+	rules, err := compileRules(release.GetRules(&s.Defaults))
+	if err != nil {
+		return err
+	}
+	fallback, err := template.New("default").Funcs(ruleFuncs).Parse(state.DefaultRuleOutputTemplate)
+	if err != nil {
+		return err
+	}
+	objs, err := manifest.ParseDir(srcDir)
+	if err != nil {
+		return err
+	}
+	var order []string
+	outputs := map[string][]*manifest.Object{}
+	for _, o := range objs {
+		tmpl := fallback
+		for _, r := range rules {
+			if r.rule.Match.Matches(o) {
+				tmpl = r.output
+				break
+			}
+		}
+		vars := ruleTemplateVars{
+			ReleaseName:      release.Name,
+			ReleaseNamespace: release.Namespace,
+			APIVersion:       o.APIVersion(),
+			Group:            o.Group(),
+			Kind:             o.Kind(),
+			Name:             o.Name(),
+			Namespace:        o.Namespace(),
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, vars); err != nil {
+			return err
+		}
+		out := filepath.Clean(strings.TrimSpace(b.String()))
+		if out == "." || out == "" {
+			return fmt.Errorf("empty output file name for %s/%s", o.Kind(), o.Name())
+		}
+		rlog.Debug().Str("kind", o.Kind()).Str("name", o.Name()).Str("output", out).Msg("routing resource")
+		if _, ok := outputs[out]; !ok {
+			order = append(order, out)
+		}
+		outputs[out] = append(outputs[out], o)
+	}
+	for _, out := range order {
+		if err := writeObjects(dstPath, out, outputs[out]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderOrdered writes objects found in srcDir to the files prefixed
+// by the apply order, e.g. 001-namespaces.yaml, 002-crds.yaml
+func renderOrdered(release *state.ReleaseSpec, s *state.ClusterSpec, srcDir, dstPath string) error {
+	objs, err := manifest.ParseDir(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, g := range manifest.Order(objs) {
+		out := fmt.Sprintf("%03d-%s.yaml", g.Index, g.Name)
+		if err := writeObjects(dstPath, out, g.Objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeObjects writes objects to the file relative to the release directory
+func writeObjects(dstPath, name string, objs []*manifest.Object) error {
+	fp, err := securejoin.SecureJoin(dstPath, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, manifest.Encode(objs), 0644)
+}
@@ -0,0 +1,136 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+const customResources = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+`
+
+func TestRenderCustom(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-custom")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	srcDir, dstPath := filepath.Join(root, "src"), filepath.Join(root, "releases", "dev", "app")
+	for _, dir := range []string{srcDir, dstPath} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create directory %v", err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(srcDir, "resources.yaml"), []byte(customResources), 0644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+	s := &state.ClusterSpec{Defaults: state.DefaultConfig{Rules: []state.RenderRule{
+		{Match: manifest.Selector{Kind: "Deployment"}, Output: "defaults.yaml"},
+		{Match: manifest.Selector{Kind: "ConfigMap"}, Output: "config/{{ .Name }}.yaml"},
+	}}}
+	release := &state.ReleaseSpec{Name: "app", RenderMode: state.RenderModeCustom, Rules: []state.RenderRule{
+		{Match: manifest.Selector{Kind: "Deployment"}, Output: "{{ .Kind | lower }}.yaml"},
+		{Match: manifest.Selector{Name: "app"}, Output: "named.yaml"},
+		{Match: manifest.Selector{Kind: "Service"}, Output: "services.yaml"},
+	}}
+	if err = renderCustom(release, s, srcDir, dstPath); err != nil {
+		t.Fatalf("failed to render %v", err)
+	}
+	exp := map[string][]string{
+		// first matching rule wins, release rules go before the default ones
+		"deployment.yaml": {"Deployment"},
+		"named.yaml":      {"Service"},
+		// default rules are used when no release rule matches
+		"config/settings.yaml": {"ConfigMap"},
+		// objects without matching rule go to the default file
+		"app.yaml": {"Secret"},
+	}
+	got := map[string][]string{}
+	err = filepath.Walk(dstPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dstPath, p)
+		if err != nil {
+			return err
+		}
+		objs, err := manifest.ParseFile(p)
+		if err != nil {
+			return err
+		}
+		for _, o := range objs {
+			got[filepath.ToSlash(rel)] = append(got[filepath.ToSlash(rel)], o.Kind())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list rendered files %v", err)
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Fatalf("unexpected rendered files (-want +got):\n%s", diff)
+	}
+}
+
+func TestRenderCustomOutputInsideOfReleaseDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-custom")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	srcDir, dstPath := filepath.Join(root, "src"), filepath.Join(root, "releases", "dev", "app")
+	for _, dir := range []string{srcDir, dstPath} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create directory %v", err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(srcDir, "resources.yaml"), []byte(customResources), 0644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+	release := &state.ReleaseSpec{Name: "app", RenderMode: state.RenderModeCustom, Rules: []state.RenderRule{
+		{Match: manifest.Selector{Kind: "Service"}, Output: "../../x.yaml"},
+	}}
+	if err = renderCustom(release, &state.ClusterSpec{}, srcDir, dstPath); err != nil {
+		t.Fatalf("failed to render %v", err)
+	}
+	var files []string
+	err = filepath.Walk(filepath.Join(root, "releases"), func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		files = append(files, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list rendered files %v", err)
+	}
+	sort.Strings(files)
+	exp := []string{filepath.Join(dstPath, "app.yaml"), filepath.Join(dstPath, "x.yaml")}
+	if diff := cmp.Diff(exp, files); diff != "" {
+		t.Fatalf("expected output to stay inside of the release directory (-want +got):\n%s", diff)
+	}
+}
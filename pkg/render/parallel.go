@@ -0,0 +1,92 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+// Status is the outcome of the release rendering
+type Status string
+
+const (
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"
+)
+
+// Result of the release rendering
+type Result struct {
+	Name     string
+	Status   Status
+	Duration time.Duration
+	Err      error
+}
+
+// Parallel runs fn for every release using the pool of workers,
+// results are returned in the same order as releases
+func Parallel(releases []state.ReleaseSpec, workers int, fn func(r *state.ReleaseSpec) (Status, error)) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]Result, len(releases))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := releases[i]
+				start := time.Now()
+				status, err := fn(&r)
+				results[i] = Result{
+					Name:     r.Name,
+					Status:   status,
+					Duration: time.Since(start),
+					Err:      err,
+				}
+			}
+		}()
+	}
+	for i := range releases {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// PrintSummary writes table with the outcome of every release to w
+func PrintSummary(results []Result, w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELEASE\tSTATUS\tDURATION\tERROR")
+	counts := map[Status]int{}
+	for _, r := range results {
+		counts[r.Status]++
+		var msg string
+		if r.Err != nil {
+			// keep table readable, full error is logged by the release
+			msg = strings.SplitN(r.Err.Error(), "\n", 2)[0]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, r.Status, r.Duration.Round(time.Millisecond), msg)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "\n%d succeeded, %d failed, %d skipped\n",
+		counts[StatusSucceeded], counts[StatusFailed], counts[StatusSkipped])
+}
+
+// HasFailures checks whether any of the releases failed to render
+func HasFailures(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFailed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+func TestParallel(t *testing.T) {
+	var releases []state.ReleaseSpec
+	for i := 0; i < 8; i++ {
+		releases = append(releases, state.ReleaseSpec{Name: fmt.Sprintf("release-%d", i)})
+	}
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	results := Parallel(releases, 3, func(r *state.ReleaseSpec) (Status, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		// first releases finish last to make sure results aren't in the order of completion
+		var i int
+		_, _ = fmt.Sscanf(r.Name, "release-%d", &i)
+		time.Sleep(time.Duration(len(releases)-i) * 5 * time.Millisecond)
+		switch i {
+		case 2:
+			return StatusFailed, errors.New("failed to render\nfull error")
+		case 5:
+			return StatusSkipped, nil
+		}
+		return StatusSucceeded, nil
+	})
+	if maxRunning > 3 {
+		t.Fatalf("expected at most 3 releases to be rendered concurrently, got %d", maxRunning)
+	}
+	if len(results) != len(releases) {
+		t.Fatalf("expected %d results, got %d", len(releases), len(results))
+	}
+	for i, res := range results {
+		if res.Name != releases[i].Name {
+			t.Fatalf("expected result %d to be of %s, got %s", i, releases[i].Name, res.Name)
+		}
+		exp := StatusSucceeded
+		switch i {
+		case 2:
+			exp = StatusFailed
+		case 5:
+			exp = StatusSkipped
+		}
+		if res.Status != exp {
+			t.Fatalf("expected %s to be %s, got %s", res.Name, exp, res.Status)
+		}
+		if (res.Err != nil) != (exp == StatusFailed) {
+			t.Fatalf("unexpected error of %s: %v", res.Name, res.Err)
+		}
+	}
+	if !HasFailures(results) {
+		t.Fatalf("expected failure of release-2 to be reported")
+	}
+	if HasFailures(results[3:]) {
+		t.Fatalf("expected no failures without release-2")
+	}
+
+	var buf bytes.Buffer
+	PrintSummary(results, &buf)
+	if !strings.Contains(buf.String(), "6 succeeded, 1 failed, 1 skipped") {
+		t.Fatalf("unexpected summary:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "full error") {
+		t.Fatalf("expected only the first line of the error in the summary:\n%s", buf.String())
+	}
+}
+
+func TestParallelWithoutWorkers(t *testing.T) {
+	releases := []state.ReleaseSpec{{Name: "a"}, {Name: "b"}}
+	results := Parallel(releases, 0, func(r *state.ReleaseSpec) (Status, error) {
+		return StatusSucceeded, nil
+	})
+	if len(results) != 2 || results[0].Name != "a" || results[1].Name != "b" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
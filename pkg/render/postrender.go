@@ -0,0 +1,181 @@
+package render
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/rs/zerolog/log"
+
+	exec_kustomize "github.com/lwolf/kube-atlas/pkg/exec/kustomize"
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/patch"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+type kustomization struct {
+	Namespace    string                 `json:"namespace,omitempty"`
+	CommonLabels map[string]string      `json:"commonLabels,omitempty"`
+	Images       []state.KustomizeImage `json:"images,omitempty"`
+	Resources    []string               `json:"resources"`
+	Patches      []kustomizePatch       `json:"patches,omitempty"`
+}
+
+type kustomizePatch struct {
+	Path   string           `json:"path"`
+	Target *kustomizeTarget `json:"target,omitempty"`
+}
+
+type kustomizeTarget struct {
+	Group         string `json:"group,omitempty"`
+	Version       string `json:"version,omitempty"`
+	Kind          string `json:"kind,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Namespace     string `json:"namespace,omitempty"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+}
+
+// postRenderKustomize generates kustomization in workDir with all the resources
+// found in srcDir, patches of the release and transformers from the release spec.
+// Result of the `kustomize build` is written to the `output` subdirectory
+func postRenderKustomize(release *state.ReleaseSpec, s *state.ClusterSpec, srcDir, workDir string) error {
+	rlog := log.With().Str("release", release.Name).Logger()
+	k := kustomization{
+		Namespace:    release.Kustomize.Namespace,
+		CommonLabels: release.Kustomize.CommonLabels,
+		Images:       release.Kustomize.Images,
+	}
+	for _, sub := range []string{"resources", "patches", "output"} {
+		if err := os.MkdirAll(filepath.Join(workDir, sub), 0755); err != nil {
+			return err
+		}
+	}
+	patchesPath, err := release.GetPatchesPath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	patches, err := patch.LoadDir(patchesPath)
+	if err != nil {
+		return err
+	}
+	// kustomize has no RFC 7386 merge patches, they are applied to the
+	// resources before the patches handled by kustomize
+	var merge, rest []patch.Patch
+	for _, p := range patches {
+		if p.Type == patch.TypeMerge {
+			merge = append(merge, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	files, err := manifest.Files(srcDir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	var resources [][]*manifest.Object
+	var all []*manifest.Object
+	for _, f := range files {
+		rel, err := filepath.Rel(srcDir, f)
+		if err != nil {
+			return err
+		}
+		objs, err := manifest.ParseFile(f)
+		if err != nil {
+			return err
+		}
+		// helm renders empty templates as well, kustomize refuses to load them
+		if len(objs) == 0 {
+			continue
+		}
+		// directory structure is kept to avoid collisions of the flattened names
+		names = append(names, path.Join("resources", filepath.ToSlash(rel)))
+		resources = append(resources, objs)
+		all = append(all, objs...)
+	}
+	if err = patch.Apply(all, merge); err != nil {
+		return err
+	}
+	for i, name := range names {
+		dst := filepath.Join(workDir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(dst, manifest.Encode(resources[i]), 0644); err != nil {
+			return err
+		}
+		k.Resources = append(k.Resources, name)
+	}
+	for i, p := range rest {
+		data, err := yaml.Marshal(p.Content)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join("patches", fmt.Sprintf("%03d-%s.yaml", i, p.Type))
+		if err = ioutil.WriteFile(filepath.Join(workDir, name), data, 0644); err != nil {
+			return err
+		}
+		k.Patches = append(k.Patches, kustomizePatch{Path: name, Target: kustomizeTargetFor(p.Target)})
+	}
+	data, err := yaml.Marshal(k)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(workDir, "kustomization.yaml"), data, 0644); err != nil {
+		return err
+	}
+	rlog.Debug().Msgf("generated kustomization:\n%s", data)
+	exec := exec_kustomize.NewExecKustomize(&log.Logger)
+	return exec.Build(workDir, "--output", filepath.Join(workDir, "output"))
+}
+
+// kustomizeTargetFor converts selector to the kustomize patch target,
+// kustomize uses regular expressions instead of shell patterns
+func kustomizeTargetFor(sel manifest.Selector) *kustomizeTarget {
+	t := &kustomizeTarget{
+		Kind:      sel.Kind,
+		Name:      globToRegexp(sel.Name),
+		Namespace: globToRegexp(sel.Namespace),
+	}
+	if sel.APIVersion != "" {
+		if i := strings.Index(sel.APIVersion, "/"); i >= 0 {
+			t.Group = sel.APIVersion[:i]
+			t.Version = sel.APIVersion[i+1:]
+		} else {
+			t.Version = sel.APIVersion
+		}
+	}
+	var labels []string
+	for k, v := range sel.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	t.LabelSelector = strings.Join(labels, ",")
+	return t
+}
+
+func globToRegexp(pattern string) string {
+	if pattern == "" || !strings.ContainsAny(pattern, "*?") {
+		return pattern
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
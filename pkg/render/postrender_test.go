@@ -0,0 +1,120 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+const testDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+      - name: sidecar
+        image: sidecar:1.0
+`
+
+const testPatches = `type: merge
+target:
+  kind: Deployment
+  name: app
+patch:
+  spec:
+    template:
+      spec:
+        containers:
+        - name: app
+          image: app:2.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 2
+`
+
+func TestPostRenderKustomizeAppliesMergePatches(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-postrender")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	// fake kustomize, only the generated kustomization is checked
+	bin := filepath.Join(root, "bin")
+	if err = os.MkdirAll(bin, 0755); err != nil {
+		t.Fatalf("failed to create directory %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(bin, "kustomize"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake kustomize %v", err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	_ = os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s := &state.ClusterSpec{Defaults: state.DefaultConfig{SourcePath: filepath.Join(root, "apps")}}
+	release := &state.ReleaseSpec{Name: "app"}
+	patchesPath, err := release.GetPatchesPath(&s.Defaults)
+	if err != nil {
+		t.Fatalf("failed to get patches path %v", err)
+	}
+	srcDir, workDir := filepath.Join(root, "src"), filepath.Join(root, "work")
+	for path, content := range map[string]string{
+		filepath.Join(srcDir, "deployment.yaml"): testDeployment,
+		filepath.Join(srcDir, "a-b", "c.yaml"):   "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a-b-c\n",
+		filepath.Join(srcDir, "a", "b-c.yaml"):   "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a-b-c-2\n",
+		filepath.Join(patchesPath, "patch.yaml"): testPatches,
+	} {
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory %v", err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file %v", err)
+		}
+	}
+	if err = postRenderKustomize(release, s, srcDir, workDir); err != nil {
+		t.Fatalf("failed to post render %v", err)
+	}
+
+	// merge patch replaces the whole list of containers
+	objs, err := manifest.ParseFile(filepath.Join(workDir, "resources", "deployment.yaml"))
+	if err != nil || len(objs) != 1 {
+		t.Fatalf("failed to parse resources %v", err)
+	}
+	data, err := yaml.Marshal(objs[0].Content["spec"])
+	if err != nil {
+		t.Fatalf("failed to marshal spec %v", err)
+	}
+	if strings.Contains(string(data), "sidecar") || !strings.Contains(string(data), "app:2.0") {
+		t.Fatalf("merge patch wasn't applied to the resource:\n%s", data)
+	}
+	var k kustomization
+	data, err = ioutil.ReadFile(filepath.Join(workDir, "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read kustomization %v", err)
+	}
+	if err = yaml.Unmarshal(data, &k); err != nil {
+		t.Fatalf("failed to parse kustomization %v", err)
+	}
+	// files with the same flattened names are kept apart
+	expResources := []string{"resources/a-b/c.yaml", "resources/a/b-c.yaml", "resources/deployment.yaml"}
+	if diff := cmp.Diff(expResources, k.Resources); diff != "" {
+		t.Fatalf("unexpected resources of the kustomization (-want +got):\n%s", diff)
+	}
+	if len(k.Patches) != 1 || !strings.HasSuffix(k.Patches[0].Path, "-strategic.yaml") {
+		t.Fatalf("expected only strategic patch to be passed to kustomize, got %+v", k.Patches)
+	}
+}
@@ -0,0 +1,26 @@
+package render
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+// Prune removes or reports (in dry-run mode) orphaned release directories
+func Prune(s *state.ClusterSpec, dryRun bool) error {
+	orphans, err := s.PruneReleaseDirectories(dryRun)
+	if err != nil {
+		return err
+	}
+	for _, p := range orphans {
+		if dryRun {
+			log.Info().Str("path", p).Msg("orphaned release directory")
+		} else {
+			log.Info().Str("path", p).Msg("orphaned release directory was removed")
+		}
+	}
+	if len(orphans) == 0 {
+		log.Info().Msg("no orphaned release directories found")
+	}
+	return nil
+}
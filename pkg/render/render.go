@@ -0,0 +1,492 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lwolf/kube-atlas/pkg/chartutil"
+	exec_helm "github.com/lwolf/kube-atlas/pkg/exec/helm"
+	exec_kustomize "github.com/lwolf/kube-atlas/pkg/exec/kustomize"
+	"github.com/lwolf/kube-atlas/pkg/fileutil"
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/patch"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+type releaseType string
+
+const (
+	releaseTypeHelm      releaseType = "helm"
+	releaseTypeKustomize releaseType = "kustomize"
+	releaseTypeRaw       releaseType = "raw"
+	releaseTypeNone      releaseType = "none"
+)
+
+func releaseContentType(release *state.ReleaseSpec, s *state.ClusterSpec) releaseType {
+	rlog := log.With().Str("release", release.Name).Logger()
+	chartPath, err := release.GetChartPath(&s.Defaults)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to get chart directory")
+		return releaseTypeNone
+	}
+	var fls []os.FileInfo
+	fls, err = ioutil.ReadDir(chartPath)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to get chart directory content")
+		return releaseTypeNone
+	}
+	if len(fls) == 0 {
+		return releaseTypeNone
+	}
+	for _, f := range fls {
+		switch f.Name() {
+		case "Chart.yaml":
+			return releaseTypeHelm
+		case "kustomization.yaml", "kustomization.yml", "Kustomization":
+			return releaseTypeKustomize
+		}
+	}
+	// raw manifests could be nested into sub-directories
+	files, err := manifest.Files(chartPath)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to get chart directory content")
+		return releaseTypeNone
+	}
+	if len(files) > 0 {
+		return releaseTypeRaw
+	}
+	return releaseTypeNone
+}
+
+func renderHelmChart(release *state.ReleaseSpec, s *state.ClusterSpec) error {
+	rlog := log.With().Str("release", release.Name).Logger()
+	renderTmp, err := ioutil.TempDir("", "helm-release-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer func() {
+		err := os.RemoveAll(renderTmp)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed remove temp directory")
+		}
+	}()
+
+	helm := exec_helm.NewExecHelm(&log.Logger)
+	args := []string{
+		"--output-dir", renderTmp,
+		"--name", release.Name,
+		"--kube-version", release.GetKubeVersion(&s.Defaults),
+	}
+	if release.Namespace != "" {
+		args = append(args, "--namespace", release.Namespace)
+	}
+	configPath, err := release.GetValuesPath(&s.Defaults)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to get values directory")
+	}
+	for _, configFile := range release.Values {
+		fullPath := filepath.Join(configPath, configFile)
+		isDir, err := fileutil.IsDir(fullPath)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed to check path")
+			continue
+		}
+		if isDir {
+			rlog.Error().Err(err).Msg("only files are supported at the moment, skipping the directory")
+			continue
+		}
+		if fileutil.Exists(fullPath) {
+			args = append(args, "--values", fullPath)
+		} else {
+			rlog.Error().Str("file", configFile).Msg("values file does not exists, skipping")
+		}
+	}
+	chartPath, err := release.GetChartPath(&s.Defaults)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to get chart directory")
+		return err
+	}
+	// helm would silently render the chart without missing subcharts
+	missing, err := chartutil.MissingDependencies(chartPath)
+	if err != nil {
+		return fmt.Errorf("failed to check chart dependencies: %v", err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("chart dependencies %s are not vendored, fetch the release or run helm dependency build", strings.Join(chartutil.DependencyNames(missing), ", "))
+	}
+	if err := helm.TemplateRelease(chartPath, args...); err != nil {
+		return err
+	}
+	var fds []os.FileInfo
+	// there should be only a single directory after helm template in the temp
+	if fds, err = ioutil.ReadDir(renderTmp); err != nil {
+		return fmt.Errorf("failed to read directory content: %v", err)
+	}
+	if len(fds) != 1 {
+		return fmt.Errorf("expected single chart directory in the helm output, found %d", len(fds))
+	}
+	chartTmpPath := filepath.Join(renderTmp, fds[0].Name())
+	separator := ""
+	if release.Kustomize.Enabled {
+		// patches are applied by kustomize together with the other transformers
+		kustomizeTmp := filepath.Join(renderTmp, "kustomize")
+		if err := postRenderKustomize(release, s, chartTmpPath, kustomizeTmp); err != nil {
+			return err
+		}
+		chartTmpPath = filepath.Join(kustomizeTmp, "output")
+		separator = "---"
+	} else if err := applyPatches(release, s, chartTmpPath); err != nil {
+		return err
+	}
+	dstPath, err := cleanReleaseDir(release, s)
+	if err != nil {
+		return err
+	}
+	return writeRendered(release, s, chartTmpPath, dstPath, separator)
+}
+
+// writeRendered writes content of the srcDir to the release directory according to the render mode
+func writeRendered(release *state.ReleaseSpec, s *state.ClusterSpec, srcDir, dstPath, separator string) error {
+	rlog := log.With().Str("release", release.Name).Logger()
+	fds, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	renderMode := release.GetRenderMode(&s.Defaults)
+	switch renderMode {
+	case state.RenderModeSingle:
+		var resultYaml bytes.Buffer
+		for _, fd := range fds {
+			err = concatYamls(filepath.Join(srcDir, fd.Name()), &resultYaml, separator)
+			if err != nil {
+				return err
+			}
+		}
+		chartFile := filepath.Join(dstPath, fmt.Sprintf("%s.%s", release.Name, "yaml"))
+		rlog.Debug().Str("chartFile", chartFile).Msg("chart file result")
+		err = ioutil.WriteFile(chartFile, resultYaml.Bytes(), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write concatenated yaml of chart: %v", err)
+		}
+	case state.RenderModeMulti:
+		for _, fd := range fds {
+			srcfp := filepath.Join(srcDir, fd.Name())
+			dstfp := filepath.Join(dstPath, fd.Name())
+			rlog.Debug().Msgf("copy from %s to %s", srcfp, dstfp)
+			if fd.IsDir() {
+				err = fileutil.CopyDir(srcfp, dstfp, "")
+			} else {
+				err = fileutil.CopyFile(srcfp, dstfp)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to copy %s: %v", fd.Name(), err)
+			}
+		}
+	case state.RenderModeCustom:
+		return renderCustom(release, s, srcDir, dstPath)
+	case state.RenderModeOrdered:
+		return renderOrdered(release, s, srcDir, dstPath)
+	default:
+		return fmt.Errorf("unknown render mode %q", renderMode)
+	}
+	return nil
+}
+
+// applyPatches applies patches from the release patches directory
+// to the rendered resources in srcDir, modified files are rewritten in place
+func applyPatches(release *state.ReleaseSpec, s *state.ClusterSpec, srcDir string) error {
+	patchesPath, err := release.GetPatchesPath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	patches, err := patch.LoadDir(patchesPath)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		return nil
+	}
+	files, err := manifest.Files(srcDir)
+	if err != nil {
+		return err
+	}
+	var objs []*manifest.Object
+	fileObjs := map[string][]*manifest.Object{}
+	for _, f := range files {
+		fobjs, err := manifest.ParseFile(f)
+		if err != nil {
+			return err
+		}
+		fileObjs[f] = fobjs
+		objs = append(objs, fobjs...)
+	}
+	if err = patch.Apply(objs, patches); err != nil {
+		return err
+	}
+	for _, f := range files {
+		for _, o := range fileObjs[f] {
+			if o.Modified() {
+				log.Debug().Str("release", release.Name).Str("file", f).Msg("writing patched file")
+				if err = ioutil.WriteFile(f, manifest.Encode(fileObjs[f]), 0644); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	log.Info().Str("release", release.Name).Int("patches", len(patches)).Msg("patches were applied")
+	return nil
+}
+
+func concatYamls(src string, buf *bytes.Buffer, separator string) error {
+	var fi os.FileInfo
+	var err error
+	if fi, err = os.Stat(src); err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		var fds []os.FileInfo
+		if fds, err = ioutil.ReadDir(src); err != nil {
+			return err
+		}
+		for _, fd := range fds {
+			err = concatYamls(path.Join(src, fd.Name()), buf, separator)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		var data []byte
+		if data, err = ioutil.ReadFile(src); err != nil {
+			return err
+		}
+		buf.Write(data)
+		// make sure separator starts from the new line
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		// XXX: is there a better way to write new line
+		if _, err = fmt.Fprintln(buf, separator); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func renderKustomize(release *state.ReleaseSpec, s *state.ClusterSpec) error {
+	rlog := log.With().Str("release", release.Name).Logger()
+	renderTmp, err := ioutil.TempDir("", "kustomize-release-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer func() {
+		err := os.RemoveAll(renderTmp)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed remove temp directory")
+		}
+	}()
+	exec := exec_kustomize.NewExecKustomize(&log.Logger)
+	chartPath, err := release.GetChartPath(&s.Defaults)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to get chart directory")
+		return err
+	}
+	args := []string{
+		"--output", renderTmp,
+	}
+	if err := exec.Build(chartPath, args...); err != nil {
+		return err
+	}
+	if err := applyPatches(release, s, renderTmp); err != nil {
+		return err
+	}
+	dstPath, err := cleanReleaseDir(release, s)
+	if err != nil {
+		return err
+	}
+	return writeRendered(release, s, renderTmp, dstPath, "---")
+}
+
+// renderRaw copies plain yaml and json manifests from the chart directory
+// (including nested directories) and writes them according to the render mode.
+// JSON files are converted to yaml
+func renderRaw(release *state.ReleaseSpec, s *state.ClusterSpec) error {
+	rlog := log.With().Str("release", release.Name).Logger()
+	renderTmp, err := ioutil.TempDir("", "raw-release-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := os.RemoveAll(renderTmp)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed remove temp directory")
+		}
+	}()
+	chartPath, err := release.GetChartPath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	files, err := manifest.Files(chartPath)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		rel, err := filepath.Rel(chartPath, f)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if strings.ToLower(filepath.Ext(f)) == ".json" {
+			data, err = yaml.JSONToYAML(data)
+			if err != nil {
+				return fmt.Errorf("failed to convert %s to yaml: %v", rel, err)
+			}
+			rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + ".yaml"
+		}
+		dst := filepath.Join(renderTmp, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		rlog.Debug().Str("file", rel).Msg("including raw manifest")
+		if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+			return err
+		}
+	}
+	if err := applyPatches(release, s, renderTmp); err != nil {
+		return err
+	}
+	dstPath, err := cleanReleaseDir(release, s)
+	if err != nil {
+		return err
+	}
+	return writeRendered(release, s, renderTmp, dstPath, "---")
+}
+
+// cleanReleaseDir removes previous content of the release directory
+func cleanReleaseDir(release *state.ReleaseSpec, s *state.ClusterSpec) (string, error) {
+	dstPath, err := release.GetReleasePath(&s.Defaults)
+	if err != nil {
+		return "", err
+	}
+	log.Debug().Str("release", release.Name).Str("path", dstPath).Msg("destination path for the rendered chart")
+	if err = os.RemoveAll(dstPath); err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dstPath, 0755); err != nil {
+		return "", err
+	}
+	return dstPath, nil
+}
+
+func copyManifests(release *state.ReleaseSpec, s *state.ClusterSpec) error {
+	rlog := log.With().Str("release", release.Name).Logger()
+	manifestsPath, err := release.GetManifestsPath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	dstPath, err := release.GetReleasePath(&s.Defaults)
+	if err != nil {
+		return err
+	}
+	// by default include all the manifests in the folder
+	// any value set in manifests key overrides it
+	manifests := release.Manifests
+	if len(release.Manifests) == 0 {
+		if !fileutil.Exists(manifestsPath) {
+			return nil
+		}
+		log.Debug().
+			Str("release", release.Name).
+			Msg("no whitelisted manifests found, including all")
+		var fds []os.FileInfo
+		if fds, err = ioutil.ReadDir(manifestsPath); err != nil {
+			return err
+		}
+		for _, f := range fds {
+			log.Debug().Msgf("including `%s`", f.Name())
+			manifests = append(manifests, f.Name())
+		}
+	}
+	for _, m := range manifests {
+		m = filepath.Clean(m)
+		mlog := rlog.With().Str("manifest", m).Logger()
+		p := filepath.Join(manifestsPath, m)
+		if !fileutil.Exists(p) {
+			mlog.Info().Str("path", p).Msg("file does not exist")
+			continue
+		}
+		isDir, err := fileutil.IsDir(p)
+		if err != nil {
+			return err
+		}
+		if isDir {
+			err = fileutil.CopyDir(p, dstPath, m)
+		} else {
+			manifestDestPath := filepath.Join(dstPath, fmt.Sprintf("manifest-%s", m))
+			rlog.Debug().Str("source", p).Str("dst", manifestDestPath).Msg("going to copy raw manifests")
+			err = fileutil.CopyFile(p, manifestDestPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy manifest %s: %v", m, err)
+		}
+	}
+	return nil
+}
+
+// Release renders chart directory of the release and copies manifests
+// to the release directory
+func Release(r *state.ReleaseSpec, s *state.ClusterSpec) error {
+	rlog := log.With().Str("release", r.Name).Logger()
+	// validate that chart directory exists and not empty
+	_, err := r.GetChartPath(&s.Defaults)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to get chart directory")
+		return err
+	}
+	// process chart directory
+	switch releaseContentType(r, s) {
+	case releaseTypeHelm:
+		err = renderHelmChart(r, s)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed to render helm chart")
+			return err
+		}
+		rlog.Info().Msg("completed rendering helm chart")
+	case releaseTypeKustomize:
+		err = renderKustomize(r, s)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed to apply kustomization")
+			return err
+		}
+		rlog.Info().Msg("completed kustomization")
+	case releaseTypeRaw:
+		err = renderRaw(r, s)
+		if err != nil {
+			rlog.Error().Err(err).Msg("failed to copy raw manifests")
+			return err
+		}
+		rlog.Info().Msg("completed copying raw manifests")
+	case releaseTypeNone:
+	default:
+		rlog.Warn().Msg("unknown release chart folder content, skipping")
+	}
+	// process manifests directory
+	err = copyManifests(r, s)
+	if err != nil {
+		rlog.Error().Err(err).Msg("failed to copy manifests")
+		return err
+	}
+	rlog.Info().Msg("manifests were copied")
+	return nil
+}
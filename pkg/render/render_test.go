@@ -0,0 +1,127 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+func TestWriteRenderedMultiFailure(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-render")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	srcDir := filepath.Join(root, "src")
+	if err = os.MkdirAll(filepath.Join(srcDir, "templates"), 0755); err != nil {
+		t.Fatalf("failed to create directory %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(srcDir, "templates", "deployment.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+	// release directory can't be created under the regular file
+	dstPath := filepath.Join(root, "file", "release")
+	if err = ioutil.WriteFile(filepath.Join(root, "file"), nil, 0644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+	release := &state.ReleaseSpec{Name: "app", RenderMode: state.RenderModeMulti}
+	if err = writeRendered(release, &state.ClusterSpec{}, srcDir, dstPath, "---"); err == nil {
+		t.Fatalf("expected copy failure to be returned")
+	}
+}
+
+func TestRenderRaw(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-render")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	s := &state.ClusterSpec{Defaults: state.DefaultConfig{
+		ClusterName: "dev",
+		SourcePath:  filepath.Join(root, "apps"),
+		ReleasePath: filepath.Join(root, "releases"),
+	}}
+	for _, mode := range []string{state.RenderModeSingle, state.RenderModeMulti} {
+		t.Run(mode, func(t *testing.T) {
+			r := &state.ReleaseSpec{Name: "app", Namespace: "default", RenderMode: mode}
+			if err := r.InitDirs(&s.Defaults); err != nil {
+				t.Fatalf("failed to create package directories %v", err)
+			}
+			chartPath, err := r.GetChartPath(&s.Defaults)
+			if err != nil {
+				t.Fatalf("failed to get chart path %v", err)
+			}
+			for name, content := range map[string]string{
+				"sub/a.yml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+				"b.json":    `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "b"}}`,
+			} {
+				path := filepath.Join(chartPath, filepath.FromSlash(name))
+				if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("failed to create directory %v", err)
+				}
+				if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write file %v", err)
+				}
+			}
+			if releaseContentType(r, s) != releaseTypeRaw {
+				t.Fatalf("expected chart directory to be detected as raw")
+			}
+			if err = renderRaw(r, s); err != nil {
+				t.Fatalf("failed to render raw release %v", err)
+			}
+			dstPath, err := r.GetReleasePath(&s.Defaults)
+			if err != nil {
+				t.Fatalf("failed to get release path %v", err)
+			}
+			var files []string
+			if mode == state.RenderModeSingle {
+				files = []string{"app.yaml"}
+			} else {
+				files = []string{"b.yaml", "sub/a.yml"}
+			}
+			var got []string
+			err = filepath.Walk(dstPath, func(p string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(dstPath, p)
+				got = append(got, filepath.ToSlash(rel))
+				return err
+			})
+			if err != nil {
+				t.Fatalf("failed to list release directory %v", err)
+			}
+			if diff := cmp.Diff(files, got); diff != "" {
+				t.Fatalf("unexpected release files (-want +got):\n%s", diff)
+			}
+			objs, err := manifest.ParseDir(dstPath)
+			if err != nil {
+				t.Fatalf("failed to parse release directory %v", err)
+			}
+			var kinds []string
+			for _, o := range objs {
+				kinds = append(kinds, o.Content["kind"].(string))
+			}
+			sort.Strings(kinds)
+			if diff := cmp.Diff([]string{"ConfigMap", "Secret"}, kinds); diff != "" {
+				t.Fatalf("unexpected rendered objects (-want +got):\n%s", diff)
+			}
+			// json is converted to yaml
+			data, err := ioutil.ReadFile(filepath.Join(dstPath, files[0]))
+			if err != nil {
+				t.Fatalf("failed to read rendered file %v", err)
+			}
+			if strings.Contains(string(data), "{") || !strings.Contains(string(data), "kind: Secret") {
+				t.Fatalf("expected json to be converted to yaml:\n%s", data)
+			}
+		})
+	}
+}
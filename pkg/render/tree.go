@@ -0,0 +1,91 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+// ToDir renders releases into dir instead of the configured release path,
+// the directory structure inside of it follows the release path template.
+// Nothing is rendered if path of any release is not inside of the dir, e.g. when
+// release path template doesn't use {{.ReleasesPath}}, to keep real releases intact
+func ToDir(releases []state.ReleaseSpec, s *state.ClusterSpec, dir string, workers int) ([]Result, error) {
+	ds := *s
+	ds.Defaults.ReleasePath = dir
+	for _, rs := range [][]state.ReleaseSpec{ds.Releases, releases} {
+		for i := range rs {
+			p, err := rs[i].GetReleasePath(&ds.Defaults)
+			if err != nil {
+				return nil, err
+			}
+			if !isInside(dir, p) {
+				return nil, fmt.Errorf("release path %s of %s is not inside of the release directory, "+
+					"release path template has to use {{.ReleasesPath}}", p, rs[i].Name)
+			}
+		}
+	}
+	err := ds.CreateReleaseDirectories()
+	if err != nil {
+		return nil, err
+	}
+	results := Parallel(releases, workers, func(r *state.ReleaseSpec) (Status, error) {
+		if err := Release(r, &ds); err != nil {
+			return StatusFailed, err
+		}
+		return StatusSucceeded, nil
+	})
+	return results, nil
+}
+
+// PrintTree writes content of every file in the dir to w, each file
+// is prefixed by the marker with its path relative to the displayPath
+func PrintTree(dir, displayPath string, w io.Writer) error {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		// drop leading document separator to avoid empty documents in the output
+		data = bytes.TrimPrefix(data, []byte("---\n"))
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		_, err = fmt.Fprintf(w, "---\n# File: %s\n%s", filepath.Join(displayPath, rel), data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isInside checks whether path p is located inside of the dir
+func isInside(dir, p string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(p))
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
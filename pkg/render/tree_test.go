@@ -0,0 +1,92 @@
+package render
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+func TestToDirKeepsReleasesOutsideOfDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-render")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	released := filepath.Join(root, "releases", "grafana", "deployment.yaml")
+	if err = os.MkdirAll(filepath.Dir(released), 0755); err != nil {
+		t.Fatalf("failed to create directory %v", err)
+	}
+	if err = ioutil.WriteFile(released, []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+	for _, template := range []string{
+		filepath.Join(root, "releases", "{{.ReleaseName}}"),
+		"releases/{{.ReleaseName}}",
+		"{{.ReleasesPath}}/../releases/{{.ReleaseName}}",
+	} {
+		t.Run(template, func(t *testing.T) {
+			tmp, err := ioutil.TempDir(root, "dry-run")
+			if err != nil {
+				t.Fatalf("failed to create temp directory %v", err)
+			}
+			s := &state.ClusterSpec{
+				Defaults: state.DefaultConfig{
+					ClusterName:         "dev",
+					ReleasePath:         filepath.Join(root, "releases"),
+					ReleasePathTemplate: template,
+				},
+				Releases: []state.ReleaseSpec{{Name: "grafana", Namespace: "monitoring"}},
+			}
+			if _, err = ToDir(s.Releases, s, tmp, 1); err == nil {
+				t.Fatalf("expected error for release path outside of %s", tmp)
+			}
+			if _, err = os.Stat(released); err != nil {
+				t.Fatalf("rendered release was removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrintTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-tree")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"dev/monitoring/prometheus/service.yaml":    "---\nkind: Service\n",
+		"dev/monitoring/prometheus/deployment.yaml": "kind: Deployment",
+		"dev/default/grafana/configmap.yaml":        "kind: ConfigMap\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory %v", err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err = PrintTree(dir, "releases", &buf); err != nil {
+		t.Fatalf("failed to print tree %v", err)
+	}
+	exp := `---
+# File: releases/dev/default/grafana/configmap.yaml
+kind: ConfigMap
+---
+# File: releases/dev/monitoring/prometheus/deployment.yaml
+kind: Deployment
+---
+# File: releases/dev/monitoring/prometheus/service.yaml
+kind: Service
+`
+	if diff := cmp.Diff(exp, buf.String()); diff != "" {
+		t.Fatalf("unexpected output (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,202 @@
+package repo
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+// Client downloads index and charts of the repository defined in the config
+type Client struct {
+	spec     state.RepositorySpec
+	cacheDir string
+	http     *http.Client
+}
+
+// DefaultCacheDir returns directory used to cache repository indexes
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "kube-atlas", "repository")
+}
+
+// NewClient creates client for the repository, indexes are cached in the cacheDir
+func NewClient(spec state.RepositorySpec, cacheDir string) (*Client, error) {
+	if spec.Name == "" || spec.URL == "" {
+		return nil, fmt.Errorf("repository name and url are required")
+	}
+	spec, err := spec.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if spec.CertFile != "" && spec.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(spec.CertFile, spec.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate of the repository %s: %v", spec.Name, err)
+		}
+		transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	return &Client{
+		spec:     spec,
+		cacheDir: cacheDir,
+		http:     &http.Client{Transport: transport},
+	}, nil
+}
+
+// CachedIndexPath returns location of the cached index of the repository
+func (c *Client) CachedIndexPath() string {
+	return filepath.Join(c.cacheDir, c.spec.Name+"-index.yaml")
+}
+
+// Index returns index of the repository, cached copy is used unless refresh is set
+func (c *Client) Index(refresh bool) (*IndexFile, error) {
+	path := c.CachedIndexPath()
+	if !refresh {
+		if index, err := LoadIndexFile(path); err == nil {
+			return index, nil
+		}
+	}
+	u, err := c.resolveURL("index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.get(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download index of the repository %s: %v", c.spec.Name, err)
+	}
+	index, err := LoadIndex(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse index of the repository %s: %v", c.spec.Name, err)
+	}
+	if err = os.MkdirAll(c.cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Resolve finds the newest version of the chart matching the version, which
+// could be either exact version or constraint. Empty version means the latest
+func (c *Client) Resolve(chart, version string, devel bool) (*ChartVersion, error) {
+	cv, err := resolve(c, chart, version, devel, false)
+	if err == nil {
+		return cv, nil
+	}
+	// cached index could be outdated, retry with the fresh one
+	return resolve(c, chart, version, devel, true)
+}
+
+func resolve(c *Client, chart, version string, devel, refresh bool) (*ChartVersion, error) {
+	index, err := c.Index(refresh)
+	if err != nil {
+		return nil, err
+	}
+	return index.Find(chart, version, devel)
+}
+
+// Download writes archive of the chart version to w
+func (c *Client) Download(cv *ChartVersion, w io.Writer) error {
+	if len(cv.URLs) == 0 {
+		return fmt.Errorf("chart %s version %s has no download urls", cv.Name, cv.Version)
+	}
+	u, err := c.resolveURL(cv.URLs[0])
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// resolveURL resolves reference relative to the repository url
+func (c *Client) resolveURL(ref string) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(c.spec.URL, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(r).String(), nil
+}
+
+// sameOrigin checks whether u has the same scheme and host as the repository url
+func (c *Client) sameOrigin(u *url.URL) bool {
+	base, err := url.Parse(c.spec.URL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(base.Scheme, u.Scheme) && strings.EqualFold(base.Host, u.Host)
+}
+
+func (c *Client) get(u string) ([]byte, error) {
+	resp, err := c.do(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *Client) do(u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// charts could be hosted elsewhere, e.g. github releases, never send
+	// credentials of the repository to another host
+	if (c.spec.Username != "" || c.spec.Password != "") && c.sameOrigin(req.URL) {
+		req.SetBasicAuth(c.spec.Username, c.spec.Password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s: %s", u, resp.Status)
+	}
+	return resp, nil
+}
+
+// Find returns the newest version of the chart matching the version constraint
+func (i *IndexFile) Find(chart, version string, devel bool) (*ChartVersion, error) {
+	var c *semver.Constraints
+	if version != "" {
+		var err error
+		c, err = semver.NewConstraint(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q of the chart %s: %v", version, chart, err)
+		}
+	}
+	versions, charts := i.Versions(chart, devel || strings.Contains(version, "-"))
+	for _, v := range versions {
+		if c == nil || c.Check(v) {
+			return charts[v], nil
+		}
+	}
+	if version == "" {
+		return nil, fmt.Errorf("chart %s not found in the repository index", chart)
+	}
+	return nil, fmt.Errorf("chart %s version %s not found in the repository index", chart, version)
+}
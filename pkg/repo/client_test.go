@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/lwolf/kube-atlas/internal/testutil"
+	"github.com/lwolf/kube-atlas/pkg/state"
+)
+
+func chartArchive(t *testing.T, name, version string) []byte {
+	return testutil.Archive(t, map[string]string{
+		name + "/Chart.yaml": fmt.Sprintf("name: %s\nversion: %s\n", name, version),
+	})
+}
+
+// chartServer serves index.yaml and archives of the demo chart behind basic auth
+func chartServer(t *testing.T, versions ...string) (*httptest.Server, *int) {
+	archives := map[string][]byte{}
+	index := "apiVersion: v1\nentries:\n  demo:\n"
+	for _, v := range versions {
+		data := chartArchive(t, "demo", v)
+		sum := sha256.Sum256(data)
+		file := fmt.Sprintf("demo-%s.tgz", v)
+		archives["/charts/"+file] = data
+		index += fmt.Sprintf("  - name: demo\n    version: %s\n    digest: %s\n    urls:\n    - %s\n", v, hex.EncodeToString(sum[:]), file)
+	}
+	indexRequests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/charts/index.yaml" {
+			indexRequests++
+			_, _ = w.Write([]byte(index))
+			return
+		}
+		data, ok := archives[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	return srv, &indexRequests
+}
+
+func TestClient(t *testing.T) {
+	srv, indexRequests := chartServer(t, "1.0.0", "1.1.0", "2.0.0-rc.1")
+	defer srv.Close()
+	cacheDir, err := ioutil.TempDir("", "test-repo-cache")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	spec := state.RepositorySpec{Name: "test", URL: srv.URL + "/charts", Username: "user", Password: "secret"}
+	client, err := NewClient(spec, cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create client %v", err)
+	}
+	tests := map[string]string{
+		"":          "1.1.0",
+		"1.0.0":     "1.0.0",
+		"v1.0.0":    "1.0.0",
+		"~1.0":      "1.0.0",
+		">=2.0.0-0": "2.0.0-rc.1",
+	}
+	for version, exp := range tests {
+		cv, err := client.Resolve("demo", version, false)
+		if err != nil {
+			t.Fatalf("failed to resolve version %q: %v", version, err)
+		}
+		if cv.Version != exp {
+			t.Fatalf("expected version %q to be resolved to %s, got %s", version, exp, cv.Version)
+		}
+	}
+	if *indexRequests != 1 {
+		t.Fatalf("expected index to be downloaded once and cached, got %d requests", *indexRequests)
+	}
+	if _, err = client.Resolve("demo", "3.0.0", false); err == nil {
+		t.Fatalf("expected error for missing chart version")
+	}
+	if *indexRequests != 2 {
+		t.Fatalf("expected index to be refreshed for missing chart version, got %d requests", *indexRequests)
+	}
+	cv, err := client.Resolve("demo", "1.0.0", false)
+	if err != nil {
+		t.Fatalf("failed to resolve chart %v", err)
+	}
+	var buf bytes.Buffer
+	if err = client.Download(cv, &buf); err != nil {
+		t.Fatalf("failed to download chart %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), chartArchive(t, "demo", "1.0.0")) {
+		t.Fatalf("downloaded chart archive doesn't match")
+	}
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	srv, _ := chartServer(t, "1.0.0")
+	defer srv.Close()
+	cacheDir, err := ioutil.TempDir("", "test-repo-cache")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	client, err := NewClient(state.RepositorySpec{Name: "test", URL: srv.URL + "/charts"}, cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create client %v", err)
+	}
+	if _, err = client.Index(true); err == nil {
+		t.Fatalf("expected error for request without credentials")
+	}
+}
+
+func TestClientDownloadFromAnotherHost(t *testing.T) {
+	archive := chartArchive(t, "demo", "1.0.0")
+	var leaked bool
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			leaked = true
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer cdn.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		index := fmt.Sprintf("apiVersion: v1\nentries:\n  demo:\n  - name: demo\n    version: 1.0.0\n    urls:\n    - %s/demo-1.0.0.tgz\n", cdn.URL)
+		_, _ = w.Write([]byte(index))
+	}))
+	defer srv.Close()
+	cacheDir, err := ioutil.TempDir("", "test-repo-cache")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	spec := state.RepositorySpec{Name: "test", URL: srv.URL + "/charts", Username: "user", Password: "secret"}
+	client, err := NewClient(spec, cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create client %v", err)
+	}
+	cv, err := client.Resolve("demo", "1.0.0", false)
+	if err != nil {
+		t.Fatalf("failed to resolve chart %v", err)
+	}
+	var buf bytes.Buffer
+	if err = client.Download(cv, &buf); err != nil {
+		t.Fatalf("failed to download chart %v", err)
+	}
+	if leaked {
+		t.Fatalf("credentials of the repository were sent to another host")
+	}
+	if !bytes.Equal(buf.Bytes(), archive) {
+		t.Fatalf("downloaded chart archive doesn't match")
+	}
+}
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/ghodss/yaml"
+)
+
+// ChartVersion is a single version of the chart from the repository index
+type ChartVersion struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	AppVersion string   `json:"appVersion,omitempty"`
+	Digest     string   `json:"digest,omitempty"`
+	URLs       []string `json:"urls"`
+}
+
+// IndexFile is the index.yaml of the helm charts repository
+type IndexFile struct {
+	APIVersion string                     `json:"apiVersion"`
+	Entries    map[string][]*ChartVersion `json:"entries"`
+}
+
+// LoadIndex parses content of the index.yaml
+func LoadIndex(data []byte) (*IndexFile, error) {
+	var i IndexFile
+	if err := yaml.Unmarshal(data, &i); err != nil {
+		return nil, err
+	}
+	if i.APIVersion == "" {
+		return nil, fmt.Errorf("no API version specified in the repository index")
+	}
+	return &i, nil
+}
+
+// LoadIndexFile reads and parses index.yaml from the disk
+func LoadIndexFile(path string) (*IndexFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadIndex(data)
+}
+
+// Get returns exact version of the chart, leading "v" is ignored
+func (i *IndexFile) Get(name, version string) (*ChartVersion, error) {
+	want, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	for _, cv := range i.Entries[name] {
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil {
+			continue
+		}
+		if v.Equal(want) {
+			return cv, nil
+		}
+	}
+	return nil, fmt.Errorf("chart %s version %s not found in the repository index", name, version)
+}
+
+// Versions returns all valid versions of the chart sorted from the newest,
+// pre-release versions are included only if devel is set
+func (i *IndexFile) Versions(name string, devel bool) ([]*semver.Version, map[*semver.Version]*ChartVersion) {
+	var versions []*semver.Version
+	charts := map[*semver.Version]*ChartVersion{}
+	for _, cv := range i.Entries[name] {
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil || (!devel && v.Prerelease() != "") {
+			continue
+		}
+		versions = append(versions, v)
+		charts[v] = cv
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+	return versions, charts
+}
+
+// HelmCacheIndexPath returns location of the repository index cached by
+// helm after "helm repo update"
+func HelmCacheIndexPath(helmHome, name string) string {
+	return filepath.Join(helmHome, "repository", "cache", name+"-index.yaml")
+}
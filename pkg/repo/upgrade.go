@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver"
+)
+
+// Upgrade describes newer versions of the chart available in the repository,
+// empty version means there is no newer version of that kind
+type Upgrade struct {
+	Chart   string
+	Current string
+	// Patch is the latest version with the same major and minor
+	Patch string
+	// Minor is the latest version with the same major
+	Minor string
+	// Major is the latest version overall
+	Major string
+	// Target is the version release should be upgraded to: the latest
+	// version satisfying the constraint or the latest minor without it
+	Target            string
+	CurrentAppVersion string
+	TargetAppVersion  string
+}
+
+// FindUpgrade looks for versions of the chart newer than the current one.
+// Constraint limits the target version, e.g. "~8.11", by default major
+// upgrades are never targeted
+func FindUpgrade(index *IndexFile, chart, current, constraint string, devel bool) (*Upgrade, error) {
+	cur, err := semver.NewVersion(current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current version %q: %v", current, err)
+	}
+	var c *semver.Constraints
+	if constraint != "" {
+		c, err = semver.NewConstraint(constraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upgrade constraint %q: %v", constraint, err)
+		}
+	}
+	versions, charts := index.Versions(chart, devel)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("chart %s not found in the repository index", chart)
+	}
+	u := &Upgrade{Chart: chart, Current: current}
+	if cv, err := index.Get(chart, current); err == nil {
+		u.CurrentAppVersion = cv.AppVersion
+	}
+	var target *semver.Version
+	// versions are sorted from the newest, first match of each kind is the latest
+	for _, v := range versions {
+		if !v.GreaterThan(cur) {
+			break
+		}
+		if u.Major == "" {
+			u.Major = v.Original()
+		}
+		if u.Minor == "" && v.Major() == cur.Major() {
+			u.Minor = v.Original()
+		}
+		if u.Patch == "" && v.Major() == cur.Major() && v.Minor() == cur.Minor() {
+			u.Patch = v.Original()
+		}
+		if target == nil {
+			if c != nil && c.Check(v) || c == nil && v.Major() == cur.Major() {
+				target = v
+			}
+		}
+	}
+	if target != nil {
+		u.Target = target.Original()
+		u.TargetAppVersion = charts[target].AppVersion
+	}
+	return u, nil
+}
@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testIndex = `apiVersion: v1
+entries:
+  prometheus:
+  - name: prometheus
+    version: 9.1.0
+    appVersion: 2.11.1
+  - name: prometheus
+    version: 8.12.1
+    appVersion: 2.10.0
+  - name: prometheus
+    version: 8.11.6
+    appVersion: 2.9.2
+  - name: prometheus
+    version: 8.11.4
+    appVersion: 2.9.2
+  - name: prometheus
+    version: 9.2.0-rc.1
+    appVersion: 2.12.0
+`
+
+func TestFindUpgrade(t *testing.T) {
+	index, err := LoadIndex([]byte(testIndex))
+	if err != nil {
+		t.Fatalf("failed to load index %v", err)
+	}
+	tests := []struct {
+		name       string
+		current    string
+		constraint string
+		devel      bool
+		exp        *Upgrade
+	}{
+		{
+			name:    "latest minor by default",
+			current: "8.11.4",
+			exp: &Upgrade{
+				Chart: "prometheus", Current: "8.11.4", Patch: "8.11.6", Minor: "8.12.1", Major: "9.1.0",
+				Target: "8.12.1", CurrentAppVersion: "2.9.2", TargetAppVersion: "2.10.0",
+			},
+		},
+		{
+			name:       "patch only constraint",
+			current:    "v8.11.4",
+			constraint: "~8.11",
+			exp: &Upgrade{
+				Chart: "prometheus", Current: "v8.11.4", Patch: "8.11.6", Minor: "8.12.1", Major: "9.1.0",
+				Target: "8.11.6", CurrentAppVersion: "2.9.2", TargetAppVersion: "2.9.2",
+			},
+		},
+		{
+			name:       "major upgrade is opt-in",
+			current:    "8.12.1",
+			constraint: ">=8.0.0",
+			exp: &Upgrade{
+				Chart: "prometheus", Current: "8.12.1", Major: "9.1.0",
+				Target: "9.1.0", CurrentAppVersion: "2.10.0", TargetAppVersion: "2.11.1",
+			},
+		},
+		{
+			name:    "pre-release with devel",
+			current: "9.1.0",
+			devel:   true,
+			exp: &Upgrade{
+				Chart: "prometheus", Current: "9.1.0", Minor: "9.2.0-rc.1", Major: "9.2.0-rc.1",
+				Target: "9.2.0-rc.1", CurrentAppVersion: "2.11.1", TargetAppVersion: "2.12.0",
+			},
+		},
+		{
+			name:    "up to date",
+			current: "9.1.0",
+			exp:     &Upgrade{Chart: "prometheus", Current: "9.1.0", CurrentAppVersion: "2.11.1"},
+		},
+	}
+	for _, tt := range tests {
+		u, err := FindUpgrade(index, "prometheus", tt.current, tt.constraint, tt.devel)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if diff := cmp.Diff(tt.exp, u); diff != "" {
+			t.Fatalf("%s: unexpected upgrade (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestFindUpgradeErrors(t *testing.T) {
+	index, err := LoadIndex([]byte(testIndex))
+	if err != nil {
+		t.Fatalf("failed to load index %v", err)
+	}
+	if _, err = FindUpgrade(index, "grafana", "1.0.0", "", false); err == nil {
+		t.Fatalf("expected error for chart missing from the index")
+	}
+	if _, err = FindUpgrade(index, "prometheus", "latest", "", false); err == nil {
+		t.Fatalf("expected error for invalid current version")
+	}
+	if _, err = FindUpgrade(index, "prometheus", "8.11.4", "~>foo", false); err == nil {
+		t.Fatalf("expected error for invalid constraint")
+	}
+}
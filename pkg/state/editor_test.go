@@ -0,0 +1,177 @@
+package state
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files of the config editor tests")
+
+// editGolden applies changes to the copy of testdata/editor/<input>.yaml and
+// compares the result with testdata/editor/<name>.golden
+func editGolden(t *testing.T, name, input string, change func(e *ConfigEditor) error) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "editor", input+".yaml"))
+	if err != nil {
+		t.Fatalf("failed to read test config %v", err)
+	}
+	path, cleanup := writeTestConfig(t, string(data))
+	defer cleanup()
+	e, err := LoadConfigEditor(path)
+	if err != nil {
+		t.Fatalf("%s: failed to load config %v", name, err)
+	}
+	if err = change(e); err != nil {
+		t.Fatalf("%s: failed to edit config %v", name, err)
+	}
+	if err = e.Save(); err != nil {
+		t.Fatalf("%s: failed to save config %v", name, err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	golden := filepath.Join("testdata", "editor", name+".golden")
+	if *updateGolden {
+		if err = ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("failed to update golden file %v", err)
+		}
+	}
+	exp, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file %v", err)
+	}
+	if diff := cmp.Diff(string(exp), string(got)); diff != "" {
+		t.Fatalf("%s: unexpected config content (-want +got):\n%s", name, diff)
+	}
+}
+
+func TestConfigEditorRoundTrip(t *testing.T) {
+	for _, input := range []string{"indent2", "indent4", "empty", "noindent", "blank"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "editor", input+".yaml"))
+		if err != nil {
+			t.Fatalf("failed to read test config %v", err)
+		}
+		path, cleanup := writeTestConfig(t, string(data))
+		defer cleanup()
+		e, err := LoadConfigEditor(path)
+		if err != nil {
+			t.Fatalf("%s: failed to load config %v", input, err)
+		}
+		if err = e.Save(); err != nil {
+			t.Fatalf("%s: failed to save config %v", input, err)
+		}
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read config %v", err)
+		}
+		if diff := cmp.Diff(string(data), string(got)); diff != "" {
+			t.Fatalf("%s: config was changed without edits (-want +got):\n%s", input, diff)
+		}
+	}
+}
+
+func TestConfigEditorReleases(t *testing.T) {
+	editGolden(t, "releases", "indent2", func(e *ConfigEditor) error {
+		if err := e.AddRelease(ReleaseSpec{Name: "grafana", Namespace: "monitoring", Chart: "stable/grafana", Version: "3.5.0", Values: []string{"values.yaml"}}); err != nil {
+			return err
+		}
+		if err := e.SetReleaseVersion("prometheus", "8.12.0"); err != nil {
+			return err
+		}
+		if err := e.UpdateRelease(ReleaseSpec{Name: "cert-manager", Chart: "jetstack/cert-manager", Version: "v0.13.0", Values: []string{"values.yaml"}}); err != nil {
+			return err
+		}
+		return e.RemoveRelease("metallb")
+	})
+}
+
+func TestConfigEditorRepositories(t *testing.T) {
+	editGolden(t, "repositories", "indent2", func(e *ConfigEditor) error {
+		if err := e.AddRepository(RepositorySpec{Name: "jetstack", URL: "https://charts.jetstack.io"}); err != nil {
+			return err
+		}
+		if err := e.UpdateRepository(RepositorySpec{Name: "private", URL: "https://charts.example.org", UsernameEnv: "CHARTS_USER", PasswordFile: "/run/secrets/charts"}); err != nil {
+			return err
+		}
+		return e.RemoveRepository("stable")
+	})
+}
+
+func TestConfigEditorIndent(t *testing.T) {
+	editGolden(t, "indent4", "indent4", func(e *ConfigEditor) error {
+		if err := e.SetReleaseVersion("prometheus", "8.12.0"); err != nil {
+			return err
+		}
+		return e.AddRelease(ReleaseSpec{Name: "grafana", Chart: "stable/grafana", Values: []string{"values.yaml"}})
+	})
+}
+
+func TestConfigEditorNoIndent(t *testing.T) {
+	editGolden(t, "noindent", "noindent", func(e *ConfigEditor) error {
+		if err := e.AddRepository(RepositorySpec{Name: "loki", URL: "https://grafana.github.io/loki/charts"}); err != nil {
+			return err
+		}
+		if err := e.SetReleaseVersion("cert-manager", "v0.13.0"); err != nil {
+			return err
+		}
+		if err := e.RemoveRelease("loki"); err != nil {
+			return err
+		}
+		return e.AddRelease(ReleaseSpec{Name: "grafana", Namespace: "monitoring", Chart: "stable/grafana", Values: []string{"values.yaml"}})
+	})
+}
+
+func TestConfigEditorBlankLines(t *testing.T) {
+	editGolden(t, "blank", "blank", func(e *ConfigEditor) error {
+		if err := e.RemoveRelease("prometheus"); err != nil {
+			return err
+		}
+		if err := e.UpdateRelease(ReleaseSpec{Name: "grafana", Namespace: "monitoring", Chart: "stable/grafana", Version: "3.5.0", Values: []string{"values.yaml"}}); err != nil {
+			return err
+		}
+		if err := e.SetReleaseVersion("cert-manager", "v0.12.0"); err != nil {
+			return err
+		}
+		return e.AddRelease(ReleaseSpec{Name: "loki", Chart: "loki/loki"})
+	})
+}
+
+func TestConfigEditorEmpty(t *testing.T) {
+	editGolden(t, "empty", "empty", func(e *ConfigEditor) error {
+		if err := e.AddRepository(RepositorySpec{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"}); err != nil {
+			return err
+		}
+		return e.AddRelease(ReleaseSpec{Name: "grafana", Namespace: "monitoring", Chart: "stable/grafana"})
+	})
+}
+
+func TestConfigEditorErrors(t *testing.T) {
+	path, cleanup := writeTestConfig(t, "defaults:\n  clusterName: dev\nreleases: prometheus\n")
+	defer cleanup()
+	e, err := LoadConfigEditor(path)
+	if err != nil {
+		t.Fatalf("failed to load config %v", err)
+	}
+	if err = e.AddRelease(ReleaseSpec{Name: "grafana"}); err == nil {
+		t.Fatalf("expected error for releases which is not a list")
+	}
+	for name, edit := range map[string]func() error{
+		"update missing release":    func() error { return e.UpdateRelease(ReleaseSpec{Name: "grafana"}) },
+		"remove missing release":    func() error { return e.RemoveRelease("grafana") },
+		"update missing repository": func() error { return e.UpdateRepository(RepositorySpec{Name: "stable"}) },
+		"remove missing repository": func() error { return e.RemoveRepository("stable") },
+	} {
+		if err = edit(); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	listPath, listCleanup := writeTestConfig(t, "- name: prometheus\n")
+	defer listCleanup()
+	if _, err = LoadConfigEditor(listPath); err == nil {
+		t.Fatalf("expected error for config which is not a mapping")
+	}
+}
@@ -0,0 +1,441 @@
+package state
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chunk is the original text of the mapping pair or of the sequence item,
+// all the fields are offsets in the config content
+type chunk struct {
+	// node is the key of the pair or the sequence item
+	node *yaml.Node
+	// head is the start of the head comment, equal to start if there is none
+	head int
+	// start is the position of the key or of the "-" of the item
+	start int
+	// end is the end of the content without trailing empty lines
+	end int
+	// trail is the start of the next chunk
+	trail int
+}
+
+// snapshot remembers the loaded nodes, parts of the tree which are the same
+// on save are copied from the original content
+func snapshot(n *yaml.Node, orig map[*yaml.Node]yaml.Node) {
+	c := *n
+	c.Content = append([]*yaml.Node(nil), n.Content...)
+	orig[n] = c
+	for _, child := range n.Content {
+		snapshot(child, orig)
+	}
+}
+
+// sameNode compares nodes without their head comments and children
+func sameNode(a, b *yaml.Node) bool {
+	return a.Kind == b.Kind && a.Style == b.Style && a.Tag == b.Tag && a.Value == b.Value &&
+		a.Anchor == b.Anchor && a.Alias == b.Alias && a.LineComment == b.LineComment &&
+		a.FootComment == b.FootComment
+}
+
+// modified checks whether the node or any of its descendants changed
+// since load, head comment of the node itself is ignored
+func (e *ConfigEditor) modified(n *yaml.Node) bool {
+	o, ok := e.orig[n]
+	if !ok || !sameNode(n, &o) || len(n.Content) != len(o.Content) {
+		return true
+	}
+	for i, c := range n.Content {
+		if c != o.Content[i] || c.HeadComment != e.orig[c].HeadComment || e.modified(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// offset converts 1-based line and column of the node to the offset in the content
+func (e *ConfigEditor) offset(line, column int) (int, bool) {
+	if line < 1 || line > len(e.lines) {
+		return 0, false
+	}
+	o := e.lines[line-1]
+	for c := 1; c < column; c++ {
+		if o >= len(e.data) || e.data[o] == '\n' {
+			return 0, false
+		}
+		_, size := utf8.DecodeRune(e.data[o:])
+		o += size
+	}
+	return o, o < len(e.data)
+}
+
+// lineStart returns offset of the line start if o is preceded only by the indentation
+func (e *ConfigEditor) lineStart(o int) (int, bool) {
+	s := bytes.LastIndexByte(e.data[:o], '\n') + 1
+	return s, len(bytes.TrimLeft(e.data[s:o], " ")) == 0
+}
+
+// trimLines moves end back over the trailing lines matching the filter
+func (e *ConfigEditor) trimLines(from, end int, trim func(l string) bool) int {
+	for end > from {
+		s := bytes.LastIndexByte(e.data[:end-1], '\n') + 1
+		if s < from || !trim(strings.TrimRight(string(e.data[s:end]), " \t\r\n")) {
+			break
+		}
+		end = s
+	}
+	return end
+}
+
+func isEmptyLine(l string) bool {
+	return strings.TrimSpace(l) == ""
+}
+
+func isCommentOrEmptyLine(l string) bool {
+	l = strings.TrimSpace(l)
+	return l == "" || strings.HasPrefix(l, "#")
+}
+
+// outerComment returns filter of the empty lines and of the comments which
+// are indented less than the children at the column, e.g. comments after the
+// last item of the sequence which don't belong to it. Comments at the column
+// of the children stay with the last child, e.g. commented out items of its value
+func outerComment(column int) func(l string) bool {
+	return func(l string) bool {
+		trimmed := strings.TrimLeft(l, " ")
+		return trimmed == "" || (strings.HasPrefix(trimmed, "#") && len(l)-len(trimmed) < column-1)
+	}
+}
+
+// chunks splits the original text of the block collection up to the end into
+// chunks of its children, false is returned if positions of the children
+// don't match the content
+func (e *ConfigEditor) chunks(n *yaml.Node, end int) ([]chunk, bool) {
+	o := e.orig[n]
+	step := 1
+	switch {
+	case o.Style&yaml.FlowStyle != 0 || len(o.Content) == 0:
+		return nil, false
+	case o.Kind == yaml.MappingNode:
+		step = 2
+	case o.Kind != yaml.SequenceNode:
+		return nil, false
+	}
+	var cs []chunk
+	prevLine := 0
+	for i := 0; i < len(o.Content); i += step {
+		c := o.Content[i]
+		column := c.Column
+		if o.Kind == yaml.SequenceNode {
+			column = o.Column
+		}
+		start, ok := e.offset(c.Line, column)
+		if !ok || (o.Kind == yaml.SequenceNode && e.data[start] != '-') {
+			return nil, false
+		}
+		ch := chunk{node: c, head: start, start: start}
+		if s, ok := e.lineStart(start); ok {
+			ch.head = s
+			if hc := e.orig[c].HeadComment; hc != "" {
+				line := c.Line - strings.Count(hc, "\n") - 1
+				if line > prevLine && e.commentLines(line, c.Line) {
+					ch.head = e.lines[line-1]
+				}
+			}
+		}
+		if len(cs) > 0 {
+			last := &cs[len(cs)-1]
+			if ch.head <= last.start {
+				return nil, false
+			}
+			last.trail = ch.head
+		}
+		cs = append(cs, ch)
+		prevLine = c.Line
+	}
+	if end <= cs[len(cs)-1].start {
+		return nil, false
+	}
+	cs[len(cs)-1].trail = end
+	for i := range cs {
+		cs[i].end = e.trimLines(cs[i].start, cs[i].trail, isEmptyLine)
+	}
+	// comments after the collection stay at the end
+	last := &cs[len(cs)-1]
+	column := o.Column
+	if o.Kind == yaml.MappingNode {
+		column = o.Content[0].Column
+	}
+	last.end = e.trimLines(last.start, last.trail, outerComment(column))
+	return cs, true
+}
+
+// commentLines checks whether lines in the range are empty or comments
+func (e *ConfigEditor) commentLines(from, to int) bool {
+	for l := from; l < to; l++ {
+		end := len(e.data)
+		if l < len(e.lines) {
+			end = e.lines[l]
+		}
+		if !isCommentOrEmptyLine(string(e.data[e.lines[l-1]:end])) {
+			return false
+		}
+	}
+	return true
+}
+
+// splice writes the block collection which occupied data[from:end] originally,
+// children which weren't changed are copied from the original content. False
+// is returned if the collection has to be encoded as a whole instead
+func (e *ConfigEditor) splice(n *yaml.Node, from, end int) ([]byte, bool, error) {
+	o, ok := e.orig[n]
+	if !ok || !sameNode(n, &o) || len(n.Content) == 0 {
+		return nil, false, nil
+	}
+	cs, ok := e.chunks(n, end)
+	if !ok {
+		return nil, false, nil
+	}
+	step := 1
+	if n.Kind == yaml.MappingNode {
+		step = 2
+	}
+	column := o.Column
+	if n.Kind == yaml.MappingNode {
+		column = o.Content[0].Column
+	}
+	// first child placed after "- " can't be removed or moved
+	if _, ok := e.lineStart(cs[0].head); !ok && n.Content[0] != o.Content[0] {
+		return nil, false, nil
+	}
+	index := map[*yaml.Node]int{}
+	for i, c := range cs {
+		index[c.node] = i
+	}
+	// separator of the added children, e.g. empty line between the items
+	var sep []byte
+	if len(cs) > 1 {
+		sep = e.data[cs[0].end:cs[0].trail]
+	}
+	var buf bytes.Buffer
+	buf.Write(e.data[from:cs[0].head])
+	for i := 0; i < len(n.Content); i += step {
+		var value *yaml.Node
+		if step == 2 {
+			value = n.Content[i+1]
+		}
+		var data []byte
+		var err error
+		next := sep
+		if j, ok := index[n.Content[i]]; ok {
+			data, err = e.spliceChild(n.Content[i], value, cs[j], column-1)
+			if j < len(cs)-1 {
+				next = e.data[cs[j].end:cs[j].trail]
+			}
+		} else {
+			data, err = e.encodeChild(n.Content[i], value, column-1, true)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		buf.Write(data)
+		if i+step < len(n.Content) {
+			if !bytes.HasSuffix(data, []byte("\n")) {
+				buf.WriteByte('\n')
+			}
+			buf.Write(next)
+		}
+	}
+	last := cs[len(cs)-1]
+	buf.Write(e.data[last.end:last.trail])
+	return buf.Bytes(), true, nil
+}
+
+// spliceChild writes the original child of the collection, only the changed
+// parts of it are encoded
+func (e *ConfigEditor) spliceChild(node, value *yaml.Node, c chunk, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	orig := e.orig[node]
+	head := node.HeadComment == orig.HeadComment
+	switch {
+	case head:
+		buf.Write(e.data[c.head:c.start])
+	case node.HeadComment != "":
+		// comment was moved to the child, e.g. from the next key
+		data, err := e.encodeChild(node, value, indent, true)
+		if _, ok := e.lineStart(c.start); !ok {
+			data = bytes.TrimLeft(data, " ")
+		}
+		return data, err
+	default:
+		// comment was moved from the child, indentation is kept
+		if s, ok := e.lineStart(c.start); ok {
+			buf.Write(e.data[s:c.start])
+		}
+	}
+	changed := e.modified(node) || (value != nil && (value.HeadComment != e.orig[value].HeadComment || e.modified(value)))
+	if !changed {
+		buf.Write(e.data[c.start:c.end])
+		return buf.Bytes(), nil
+	}
+	// nested collection, e.g. the release in the list of releases
+	collection := node
+	if value != nil {
+		collection = value
+		if !sameNode(node, &orig) || value.HeadComment != e.orig[value].HeadComment {
+			collection = nil
+		}
+	}
+	if collection != nil && (collection.Kind == yaml.MappingNode || collection.Kind == yaml.SequenceNode) {
+		data, ok, err := e.splice(collection, c.start, c.end)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			buf.Write(data)
+			return buf.Bytes(), nil
+		}
+	}
+	// comments after the content are kept as is, e.g. commented out items
+	end := e.trimLines(c.start, c.end, isCommentOrEmptyLine)
+	data, err := e.encodeChild(node, value, indent, false)
+	if err != nil {
+		return nil, err
+	}
+	// indentation of the first line is already written
+	buf.Write(bytes.TrimLeft(data, " "))
+	buf.Write(e.data[end:c.end])
+	return buf.Bytes(), nil
+}
+
+// encodeChild encodes the mapping pair or the sequence item indented by the
+// given number of spaces. Foot comments at the end of the child are written
+// only with the head comment, otherwise they are copied from the original content
+func (e *ConfigEditor) encodeChild(node, value *yaml.Node, indent int, withComments bool) ([]byte, error) {
+	var n *yaml.Node
+	if value != nil {
+		n = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{node, value}}
+	} else {
+		n = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{node}}
+	}
+	if !withComments {
+		n = withoutFootComments(n)
+		first := *n.Content[0]
+		first.HeadComment = ""
+		n.Content[0] = &first
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(e.indent)
+	if err := enc.Encode(n); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	if e.compactSeq {
+		data = compactSequences(data)
+	}
+	if indent == 0 {
+		return data, nil
+	}
+	prefix := []byte(strings.Repeat(" ", indent))
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	var out bytes.Buffer
+	for _, l := range lines {
+		if len(bytes.TrimSpace(l)) > 0 {
+			out.Write(prefix)
+		}
+		out.Write(l)
+	}
+	return out.Bytes(), nil
+}
+
+// withoutFootComments returns copy of the node without foot comments
+// of its last descendants, which are written after all of its content
+func withoutFootComments(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.FootComment = ""
+	if last := len(c.Content) - 1; last >= 0 {
+		c.Content = append([]*yaml.Node(nil), n.Content...)
+		c.Content[last] = withoutFootComments(c.Content[last])
+		if c.Kind == yaml.MappingNode && last > 0 {
+			key := *c.Content[last-1]
+			key.FootComment = ""
+			c.Content[last-1] = &key
+		}
+	}
+	return &c
+}
+
+// detectCompactSequences checks whether block sequences of the config are
+// placed at the column of their keys, e.g. "releases:\n- name: grafana"
+func detectCompactSequences(n *yaml.Node) bool {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if v.Kind == yaml.SequenceNode && v.Style&yaml.FlowStyle == 0 && len(v.Content) > 0 {
+				return v.Column == k.Column
+			}
+		}
+	}
+	for _, c := range n.Content {
+		if detectCompactSequences(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// compactSequences moves block sequences of the encoded yaml to the column of
+// their keys. Lines to move are found by the positions of the parsed nodes
+func compactSequences(data []byte) []byte {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return data
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	shift := make([]int, len(lines)+1)
+	var walk func(n *yaml.Node, end int)
+	walk = func(n *yaml.Node, end int) {
+		step := 1
+		if n.Kind == yaml.MappingNode {
+			step = 2
+		}
+		for i := 0; i < len(n.Content); i += step {
+			next := end
+			if i+step < len(n.Content) {
+				c := n.Content[i+step]
+				next = c.Line - strings.Count(c.HeadComment, "\n")
+				if c.HeadComment != "" {
+					next--
+				}
+			}
+			if step == 1 {
+				walk(n.Content[i], next)
+				continue
+			}
+			k, v := n.Content[i], n.Content[i+1]
+			if v.Kind == yaml.SequenceNode && v.Style&yaml.FlowStyle == 0 && v.Column > k.Column {
+				for l := k.Line + 1; l < next && l <= len(lines); l++ {
+					shift[l] += v.Column - k.Column
+				}
+			}
+			walk(v, next)
+		}
+	}
+	walk(&doc, len(lines)+1)
+	var out bytes.Buffer
+	for i, l := range lines {
+		s := shift[i+1]
+		if s > 0 && len(l) > s && len(bytes.TrimLeft(l[:s], " ")) == 0 {
+			l = l[s:]
+		}
+		out.Write(l)
+	}
+	return out.Bytes()
+}
@@ -2,26 +2,46 @@ package state
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
 
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/spf13/viper"
+
+	"github.com/lwolf/kube-atlas/pkg/manifest"
+	"github.com/lwolf/kube-atlas/pkg/oci"
 )
 
 const (
 	RenderModeSingle           = "single"
 	RenderModeMulti            = "multi"
 	RenderModeCustom           = "custom"
+	RenderModeOrdered          = "ordered"
 	DefaultChartDir            = "chart"
 	DefaultManifestsDir        = "manifests"
 	DefaultValuesDir           = "values"
 	DefaultPatchesDir          = "patches"
+	DefaultSourceDir           = "apps"
 	DefaultReleaseDir          = "releases"
 	DefaultKubeVersion         = "1.14.1-0"
 	DefaultRenderMode          = RenderModeSingle
 	DefaultReleasePathTemplate = "{{.ReleasesPath}}/{{.ClusterName}}/{{.ReleaseNamespace}}/{{.ReleaseName}}"
+	DefaultRuleOutputTemplate  = "{{.ReleaseName}}.yaml"
+
+	// SourceTypeRepository is the chart from the classic helm repository, e.g. stable/prometheus
+	SourceTypeRepository = "repository"
+	// SourceTypeOCI is the chart from the OCI registry, e.g. oci://registry.local/charts/prometheus
+	SourceTypeOCI = "oci"
+	// SourceTypeGit is the chart or manifests from the git repository
+	SourceTypeGit = "git"
+	// SourceTypeLocal is the chart maintained locally, it's never fetched
+	SourceTypeLocal = "local"
+	// SourceTypeNone is used by releases without chart source, e.g. with raw manifests
+	SourceTypeNone = "none"
 )
 
 type DefaultConfig struct {
@@ -35,6 +55,8 @@ type DefaultConfig struct {
 	KubeVersion         string `yaml:"kubeVersion"`
 	RenderMode          string `yaml:"renderMode"`
 	ReleasePathTemplate string `yaml:"releasePathTemplate"`
+	// Rules are used by the custom render mode, evaluated after the release rules
+	Rules []RenderRule `yaml:"rules"`
 }
 
 func (dc *DefaultConfig) GetReleasePath() string {
@@ -124,6 +146,58 @@ func (cs *ClusterSpec) ReleaseByName(name string) *ReleaseSpec {
 	return nil
 }
 
+// RepositoryByName returns repository from the config or nil if it doesn't exist
+func (cs *ClusterSpec) RepositoryByName(name string) *RepositorySpec {
+	for _, r := range cs.Repositories {
+		if r.Name == name {
+			return &r
+		}
+	}
+	return nil
+}
+
+// DuplicateRepositories returns names of the repositories defined more than once
+func (cs *ClusterSpec) DuplicateRepositories() []string {
+	seen := map[string]int{}
+	var dups []string
+	for _, r := range cs.Repositories {
+		seen[r.Name]++
+		if seen[r.Name] == 2 {
+			dups = append(dups, r.Name)
+		}
+	}
+	return dups
+}
+
+// RepositoryByURLPrefix returns resolved repository which url is the prefix
+// of the chart reference, e.g. oci://registry.local/charts for
+// oci://registry.local/charts/prometheus, nil if there is no such repository.
+// Urls are expanded before matching, error is returned if url of any of the
+// repositories couldn't be expanded and none of the others matches
+func (cs *ClusterSpec) RepositoryByURLPrefix(chart string) (*RepositorySpec, error) {
+	var expandErr error
+	for _, r := range cs.Repositories {
+		if r.URL == "" {
+			continue
+		}
+		u, err := r.expandURL()
+		if err != nil {
+			if expandErr == nil {
+				expandErr = err
+			}
+			continue
+		}
+		if strings.HasPrefix(chart, strings.TrimSuffix(u, "/")+"/") {
+			resolved, err := r.Resolve()
+			if err != nil {
+				return nil, err
+			}
+			return &resolved, nil
+		}
+	}
+	return nil, expandErr
+}
+
 func (cs *ClusterSpec) CreateSourceDirectories() error {
 	for _, r := range cs.Releases {
 		err := r.InitDirs(&cs.Defaults)
@@ -153,14 +227,180 @@ func (cs *ClusterSpec) CreateReleaseDirectories() error {
 	return nil
 }
 
+// OrphanedReleasePaths returns directories under the release path which
+// don't belong to any of the releases, e.g. after release was removed from
+// the config or its namespace or cluster has changed
+func (cs *ClusterSpec) OrphanedReleasePaths() ([]string, error) {
+	root := filepath.Clean(cs.Defaults.GetReleasePath())
+	expected := map[string]bool{}
+	ancestors := map[string]bool{root: true}
+	for _, r := range cs.Releases {
+		p, err := r.GetReleasePath(&cs.Defaults)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("release path %s of %s is not inside of the release directory %s", p, r.Name, root)
+		}
+		expected[p] = true
+		for dir := filepath.Dir(p); dir != root && dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			ancestors[dir] = true
+		}
+	}
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+	var orphans []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || p == root {
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(info.Name(), "."):
+			return filepath.SkipDir
+		case expected[p]:
+			return filepath.SkipDir
+		case ancestors[p]:
+			return nil
+		}
+		orphans = append(orphans, p)
+		return filepath.SkipDir
+	})
+	return orphans, err
+}
+
+// PruneReleaseDirectories removes orphaned release directories,
+// nothing is removed in the dry-run mode
+func (cs *ClusterSpec) PruneReleaseDirectories(dryRun bool) ([]string, error) {
+	orphans, err := cs.OrphanedReleasePaths()
+	if err != nil || dryRun {
+		return orphans, err
+	}
+	for _, p := range orphans {
+		if err := os.RemoveAll(p); err != nil {
+			return nil, err
+		}
+	}
+	return orphans, nil
+}
+
+// ReleaseDirectories returns existing directories owned by the release: rendered
+// output and, if withSource is set, the package directory. Release directory
+// shared with other releases or not inside of the release path is never returned
+func (cs *ClusterSpec) ReleaseDirectories(r *ReleaseSpec, withSource bool) ([]string, error) {
+	var dirs []string
+	if withSource {
+		pkgPath, err := r.GetPkgPath(&cs.Defaults)
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := os.Stat(pkgPath); err == nil && fi.IsDir() {
+			dirs = append(dirs, pkgPath)
+		}
+	}
+	root := filepath.Clean(cs.Defaults.GetReleasePath())
+	p, err := r.GetReleasePath(&cs.Defaults)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return dirs, nil
+	}
+	for i := range cs.Releases {
+		other := &cs.Releases[i]
+		if other.Name == r.Name {
+			continue
+		}
+		op, err := other.GetReleasePath(&cs.Defaults)
+		if err != nil {
+			return nil, err
+		}
+		if op == p || strings.HasPrefix(op, p+string(filepath.Separator)) {
+			return dirs, nil
+		}
+	}
+	if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+		dirs = append(dirs, p)
+	}
+	return dirs, nil
+}
+
+// RenderRule routes rendered resources matching the selector to the output file.
+// Output is a go template string relative to the release path, valid variables are:
+// ReleaseName, ReleaseNamespace, APIVersion, Group, Kind, Name and Namespace
+type RenderRule struct {
+	Match  manifest.Selector `yaml:"match"`
+	Output string            `yaml:"output"`
+}
+
 // RepositorySpec defines values for a helm charts repo
 type RepositorySpec struct {
-	Name     string `yaml:"name"`
+	Name string `yaml:"name"`
+	// URL of the repository, ${VAR} references to environment variables are expanded
 	URL      string `yaml:"url"`
 	CertFile string `yaml:"certFile"`
 	KeyFile  string `yaml:"keyFile"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// UsernameEnv is the name of the environment variable with the username
+	UsernameEnv string `yaml:"usernameEnv"`
+	// PasswordEnv is the name of the environment variable with the password
+	PasswordEnv string `yaml:"passwordEnv"`
+	// PasswordFile is the path of the file with the password
+	PasswordFile string `yaml:"passwordFile"`
+}
+
+// Resolve returns copy of the repository with expanded url and credentials
+// read from the environment variables or the password file
+func (r RepositorySpec) Resolve() (RepositorySpec, error) {
+	u, err := r.expandURL()
+	if err != nil {
+		return r, err
+	}
+	r.URL = u
+	if r.UsernameEnv != "" {
+		r.Username = os.Getenv(r.UsernameEnv)
+		if r.Username == "" {
+			return r, fmt.Errorf("environment variable %s with the username of the repository %s is not set", r.UsernameEnv, r.Name)
+		}
+	}
+	switch {
+	case r.PasswordEnv != "" && r.PasswordFile != "":
+		return r, fmt.Errorf("only one of passwordEnv and passwordFile could be set for the repository %s", r.Name)
+	case r.PasswordEnv != "":
+		r.Password = os.Getenv(r.PasswordEnv)
+		if r.Password == "" {
+			return r, fmt.Errorf("environment variable %s with the password of the repository %s is not set", r.PasswordEnv, r.Name)
+		}
+	case r.PasswordFile != "":
+		data, err := ioutil.ReadFile(r.PasswordFile)
+		if err != nil {
+			return r, fmt.Errorf("failed to read password of the repository %s: %v", r.Name, err)
+		}
+		r.Password = strings.TrimRight(string(data), "\r\n")
+	}
+	return r, nil
+}
+
+// expandURL replaces ${VAR} references in the url with the environment variables
+func (r RepositorySpec) expandURL() (string, error) {
+	var missing []string
+	u := os.Expand(r.URL, func(name string) string {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return u, fmt.Errorf("environment variables %s used in the url of the repository %s are not set", strings.Join(missing, ", "), r.Name)
+	}
+	return u, nil
 }
 
 // ReleaseSpec defines the structure of a release
@@ -168,17 +408,55 @@ type ReleaseSpec struct {
 	Version     string `yaml:"version"`
 	KubeVersion string `yaml:"kubeVersion"`
 	// Name is the name of this release
-	Name  string `yaml:"name"`
+	Name string `yaml:"name"`
+	// Chart is either repo/chart, oci:// reference or path of the local
+	// chart relative to the project root, e.g. ./charts/app
 	Chart string `yaml:"chart"`
+	// Source could be set to "local" to never fetch the chart of the release
+	Source string `yaml:"source"`
 	// Devel, when set to true, use development versions, too. Equivalent to version '>0.0.0-0'
-	Devel       bool     `yaml:"devel"`
-	Dirty       bool     `yaml:"dirty"`
-	Namespace   string   `yaml:"namespace"`
-	ReleasePath string   `yaml:"release_path"`
-	ClusterName string   `yaml:"clusterName"`
-	RenderMode  string   `yaml:"renderMode"`
-	Values      []string `yaml:"values"`
-	Manifests   []string `yaml:"manifests"`
+	Devel bool `yaml:"devel"`
+	// UpgradeConstraint limits versions considered by the repo upgrade, e.g. "~8.11"
+	UpgradeConstraint string   `yaml:"upgradeConstraint"`
+	Dirty             bool     `yaml:"dirty"`
+	Namespace         string   `yaml:"namespace"`
+	ReleasePath       string   `yaml:"release_path"`
+	ClusterName       string   `yaml:"clusterName"`
+	RenderMode        string   `yaml:"renderMode"`
+	Values            []string `yaml:"values"`
+	Manifests         []string `yaml:"manifests"`
+	// Rules are used by the custom render mode, first matching rule wins
+	Rules []RenderRule `yaml:"rules"`
+	// Kustomize enables post-rendering of the helm chart output with kustomize
+	Kustomize KustomizeSpec `yaml:"kustomize"`
+	// Git vendors chart, kustomize base or manifests from the git repository
+	Git GitSpec `yaml:"git"`
+}
+
+// GitSpec defines location of the release source in the git repository
+type GitSpec struct {
+	URL string `yaml:"url"`
+	// Ref is the branch, tag or commit to checkout, HEAD is used if empty
+	Ref string `yaml:"ref"`
+	// Path is the directory inside of the repository, root is used if empty
+	Path string `yaml:"path"`
+}
+
+// KustomizeSpec defines transformers of the generated kustomization,
+// patches from the package patches directory are always included
+type KustomizeSpec struct {
+	Enabled      bool              `yaml:"enabled"`
+	Namespace    string            `yaml:"namespace"`
+	CommonLabels map[string]string `yaml:"commonLabels"`
+	Images       []KustomizeImage  `yaml:"images"`
+}
+
+// KustomizeImage overrides name, tag or digest of the image
+type KustomizeImage struct {
+	Name    string `yaml:"name" json:"name"`
+	NewName string `yaml:"newName" json:"newName,omitempty"`
+	NewTag  string `yaml:"newTag" json:"newTag,omitempty"`
+	Digest  string `yaml:"digest" json:"digest,omitempty"`
 }
 
 type releaseTemplateVars struct {
@@ -219,6 +497,48 @@ func (r *ReleaseSpec) GetRenderMode(d *DefaultConfig) string {
 	return d.GetRenderMode()
 }
 
+// GetRules returns release rules followed by the default ones
+func (r *ReleaseSpec) GetRules(d *DefaultConfig) []RenderRule {
+	var rules []RenderRule
+	rules = append(rules, r.Rules...)
+	return append(rules, d.Rules...)
+}
+
+// SourceType returns type of the chart source of the release
+func (r *ReleaseSpec) SourceType() string {
+	switch {
+	case r.Source == SourceTypeLocal || isLocalPath(r.Chart):
+		return SourceTypeLocal
+	case r.Git.URL != "":
+		return SourceTypeGit
+	case oci.IsReference(r.Chart):
+		return SourceTypeOCI
+	case r.Chart != "":
+		return SourceTypeRepository
+	}
+	return SourceTypeNone
+}
+
+// RepositoryName returns name of the repository part of the chart reference,
+// e.g. stable for stable/prometheus
+func (r *ReleaseSpec) RepositoryName() string {
+	if r.SourceType() != SourceTypeRepository {
+		return ""
+	}
+	if i := strings.Index(r.Chart, "/"); i > 0 {
+		return r.Chart[:i]
+	}
+	return ""
+}
+
+// ChartName returns name of the chart without the repository part
+func (r *ReleaseSpec) ChartName() string {
+	if i := strings.LastIndex(r.Chart, "/"); i >= 0 {
+		return r.Chart[i+1:]
+	}
+	return r.Chart
+}
+
 func (r *ReleaseSpec) GetClusterName(d *DefaultConfig) string {
 	if r.ClusterName != "" {
 		return r.ClusterName
@@ -230,7 +550,21 @@ func (r *ReleaseSpec) GetPkgPath(d *DefaultConfig) (string, error) {
 	return securejoin.SecureJoin(d.SourcePath, r.Name)
 }
 
+// isLocalPath returns true if chart is referenced by the path
+func isLocalPath(chart string) bool {
+	return chart == "." || chart == ".." || strings.HasPrefix(chart, "./") || strings.HasPrefix(chart, "../") || filepath.IsAbs(chart)
+}
+
+// GetChartPath returns chart directory of the package or path of the local
+// chart, which is not allowed to point outside of the project root
 func (r *ReleaseSpec) GetChartPath(d *DefaultConfig) (string, error) {
+	if isLocalPath(r.Chart) {
+		rel := filepath.Clean(r.Chart)
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("chart path %s of the release %s points outside of the project root", r.Chart, r.Name)
+		}
+		return securejoin.SecureJoin(".", rel)
+	}
 	pkgPath, err := r.GetPkgPath(d)
 	if err != nil {
 		return "", nil
@@ -0,0 +1,293 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOrphanedReleasePaths(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-releases")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, d := range []string{
+		"dev/monitoring/prometheus",
+		"dev/monitoring/grafana",
+		"dev/logging/loki",
+		"old/monitoring/prometheus",
+		".git/objects",
+	} {
+		if err = os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatalf("failed to create directory %v", err)
+		}
+	}
+	cs := ClusterSpec{
+		Defaults: DefaultConfig{ReleasePath: root, ClusterName: "dev"},
+		Releases: []ReleaseSpec{
+			{Name: "prometheus", Namespace: "monitoring"},
+			{Name: "nginx", Namespace: "ingress"},
+		},
+	}
+	orphans, err := cs.OrphanedReleasePaths()
+	if err != nil {
+		t.Fatalf("failed to find orphaned paths %v", err)
+	}
+	exp := []string{
+		filepath.Join(root, "dev/logging"),
+		filepath.Join(root, "dev/monitoring/grafana"),
+		filepath.Join(root, "old"),
+	}
+	if !cmp.Equal(exp, orphans) {
+		t.Fatalf("expected orphaned paths %v, but got %v", exp, orphans)
+	}
+	if _, err = cs.PruneReleaseDirectories(false); err != nil {
+		t.Fatalf("failed to prune %v", err)
+	}
+	orphans, _ = cs.OrphanedReleasePaths()
+	if len(orphans) != 0 {
+		t.Fatalf("expected all orphaned paths to be removed, got %v", orphans)
+	}
+}
+
+func TestOrphanedReleasePathsOutsideOfReleaseDir(t *testing.T) {
+	cs := ClusterSpec{
+		Defaults: DefaultConfig{
+			ReleasePath:         "releases",
+			ReleasePathTemplate: "elsewhere/{{.ReleaseName}}",
+		},
+		Releases: []ReleaseSpec{{Name: "prometheus"}},
+	}
+	if _, err := cs.OrphanedReleasePaths(); err == nil {
+		t.Fatal("expected error for the release path outside of release directory")
+	}
+}
+
+func TestDuplicateRepositories(t *testing.T) {
+	s := &ClusterSpec{Repositories: []RepositorySpec{
+		{Name: "appscode", URL: "https://charts.appscode.com/stable/"},
+		{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"},
+		{Name: "appscode", URL: "https://charts.appscode.com/stable/"},
+		{Name: "appscode", URL: "https://charts.appscode.com/stable/"},
+	}}
+	if diff := cmp.Diff([]string{"appscode"}, s.DuplicateRepositories()); diff != "" {
+		t.Fatalf("unexpected duplicates (-want +got):\n%s", diff)
+	}
+}
+
+func TestRepositoryResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-repository")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	if err = ioutil.WriteFile(passwordFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write password file %v", err)
+	}
+	os.Setenv("KUBE_ATLAS_TEST_HOST", "charts.local")
+	os.Setenv("KUBE_ATLAS_TEST_USER", "user")
+	os.Setenv("KUBE_ATLAS_TEST_PASSWORD", "env-secret")
+	defer func() {
+		os.Unsetenv("KUBE_ATLAS_TEST_HOST")
+		os.Unsetenv("KUBE_ATLAS_TEST_USER")
+		os.Unsetenv("KUBE_ATLAS_TEST_PASSWORD")
+	}()
+	tests := []struct {
+		name string
+		spec RepositorySpec
+		exp  RepositorySpec
+		err  bool
+	}{
+		{
+			name: "inline credentials",
+			spec: RepositorySpec{Name: "r", URL: "https://charts.local", Username: "u", Password: "p"},
+			exp:  RepositorySpec{Name: "r", URL: "https://charts.local", Username: "u", Password: "p"},
+		},
+		{
+			name: "environment",
+			spec: RepositorySpec{Name: "r", URL: "https://${KUBE_ATLAS_TEST_HOST}/stable", UsernameEnv: "KUBE_ATLAS_TEST_USER", PasswordEnv: "KUBE_ATLAS_TEST_PASSWORD"},
+			exp: RepositorySpec{Name: "r", URL: "https://charts.local/stable", Username: "user", Password: "env-secret",
+				UsernameEnv: "KUBE_ATLAS_TEST_USER", PasswordEnv: "KUBE_ATLAS_TEST_PASSWORD"},
+		},
+		{
+			name: "password file",
+			spec: RepositorySpec{Name: "r", URL: "https://charts.local", Username: "u", PasswordFile: passwordFile},
+			exp:  RepositorySpec{Name: "r", URL: "https://charts.local", Username: "u", Password: "file-secret", PasswordFile: passwordFile},
+		},
+		{
+			name: "missing url variable",
+			spec: RepositorySpec{Name: "r", URL: "https://${KUBE_ATLAS_TEST_MISSING}"},
+			err:  true,
+		},
+		{
+			name: "missing password variable",
+			spec: RepositorySpec{Name: "r", URL: "https://charts.local", PasswordEnv: "KUBE_ATLAS_TEST_MISSING"},
+			err:  true,
+		},
+		{
+			name: "both password sources",
+			spec: RepositorySpec{Name: "r", URL: "https://charts.local", PasswordEnv: "KUBE_ATLAS_TEST_PASSWORD", PasswordFile: passwordFile},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.spec.Resolve()
+		if tt.err {
+			if err == nil {
+				t.Fatalf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if diff := cmp.Diff(tt.exp, got); diff != "" {
+			t.Fatalf("%s: unexpected repository (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestRepositoryByURLPrefix(t *testing.T) {
+	os.Setenv("KUBE_ATLAS_TEST_REGISTRY", "registry.local")
+	os.Setenv("KUBE_ATLAS_TEST_USER", "user")
+	defer func() {
+		os.Unsetenv("KUBE_ATLAS_TEST_REGISTRY")
+		os.Unsetenv("KUBE_ATLAS_TEST_USER")
+	}()
+	cs := ClusterSpec{Repositories: []RepositorySpec{
+		{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"},
+		{Name: "registry", URL: "oci://${KUBE_ATLAS_TEST_REGISTRY}/charts", UsernameEnv: "KUBE_ATLAS_TEST_USER", Password: "secret"},
+	}}
+	r, err := cs.RepositoryByURLPrefix("oci://registry.local/charts/prometheus")
+	if err != nil {
+		t.Fatalf("failed to find repository %v", err)
+	}
+	exp := &RepositorySpec{Name: "registry", URL: "oci://registry.local/charts", Username: "user", UsernameEnv: "KUBE_ATLAS_TEST_USER", Password: "secret"}
+	if diff := cmp.Diff(exp, r); diff != "" {
+		t.Fatalf("unexpected repository (-want +got):\n%s", diff)
+	}
+	if r, err = cs.RepositoryByURLPrefix("oci://other.local/charts/prometheus"); err != nil || r != nil {
+		t.Fatalf("expected no repository, got %v, %v", r, err)
+	}
+
+	// url which can't be expanded could belong to the chart
+	os.Unsetenv("KUBE_ATLAS_TEST_REGISTRY")
+	if _, err = cs.RepositoryByURLPrefix("oci://registry.local/charts/prometheus"); err == nil {
+		t.Fatalf("expected error for the repository url which can't be expanded")
+	}
+	// credentials of the matching repository are required
+	os.Setenv("KUBE_ATLAS_TEST_REGISTRY", "registry.local")
+	os.Unsetenv("KUBE_ATLAS_TEST_USER")
+	if _, err = cs.RepositoryByURLPrefix("oci://registry.local/charts/prometheus"); err == nil {
+		t.Fatalf("expected error for missing credentials")
+	}
+}
+
+func TestSourceType(t *testing.T) {
+	for _, tc := range []struct {
+		release ReleaseSpec
+		exp     string
+	}{
+		{ReleaseSpec{Chart: "stable/prometheus"}, SourceTypeRepository},
+		{ReleaseSpec{Chart: "oci://registry.example.com/charts/app"}, SourceTypeOCI},
+		{ReleaseSpec{Git: GitSpec{URL: "https://example.com/charts.git"}}, SourceTypeGit},
+		{ReleaseSpec{Chart: "./charts/app"}, SourceTypeLocal},
+		{ReleaseSpec{Chart: "stable/prometheus", Source: SourceTypeLocal}, SourceTypeLocal},
+		{ReleaseSpec{}, SourceTypeNone},
+	} {
+		if got := tc.release.SourceType(); got != tc.exp {
+			t.Fatalf("unexpected source type of %+v: expected %s, got %s", tc.release, tc.exp, got)
+		}
+	}
+}
+
+func TestGetChartPathOfLocalChart(t *testing.T) {
+	d := &DefaultConfig{SourcePath: "src"}
+	for _, tc := range []struct {
+		chart string
+		exp   string
+		err   bool
+	}{
+		{chart: "./charts/app", exp: "charts/app"},
+		{chart: "./charts/../shared/app", exp: "shared/app"},
+		{chart: "../outside", err: true},
+		{chart: "./charts/../../outside", err: true},
+		{chart: "/etc/app", err: true},
+	} {
+		r := ReleaseSpec{Name: "app", Chart: tc.chart}
+		got, err := r.GetChartPath(d)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("expected error for chart %s, got path %s", tc.chart, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to get chart path of %s %v", tc.chart, err)
+		}
+		if got != tc.exp {
+			t.Fatalf("unexpected chart path of %s: expected %s, got %s", tc.chart, tc.exp, got)
+		}
+	}
+}
+
+func TestReleaseDirectories(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-releases")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, d := range []string{
+		"apps/prometheus/chart",
+		"releases/dev/monitoring/prometheus",
+		"releases/dev/monitoring/grafana",
+		"releases/dev/logging",
+	} {
+		if err = os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatalf("failed to create directory %v", err)
+		}
+	}
+	cs := ClusterSpec{
+		Defaults: DefaultConfig{
+			SourcePath:  filepath.Join(root, "apps"),
+			ReleasePath: filepath.Join(root, "releases"),
+			ClusterName: "dev",
+		},
+		Releases: []ReleaseSpec{
+			{Name: "prometheus", Namespace: "monitoring"},
+			{Name: "grafana", Namespace: "monitoring"},
+		},
+	}
+	for _, tc := range []struct {
+		release    string
+		withSource bool
+		exp        []string
+	}{
+		{"prometheus", true, []string{filepath.Join(root, "apps/prometheus"), filepath.Join(root, "releases/dev/monitoring/prometheus")}},
+		{"prometheus", false, []string{filepath.Join(root, "releases/dev/monitoring/prometheus")}},
+		// package directory doesn't exist
+		{"grafana", true, []string{filepath.Join(root, "releases/dev/monitoring/grafana")}},
+	} {
+		dirs, err := cs.ReleaseDirectories(cs.ReleaseByName(tc.release), tc.withSource)
+		if err != nil {
+			t.Fatalf("failed to get directories of %s %v", tc.release, err)
+		}
+		if diff := cmp.Diff(tc.exp, dirs); diff != "" {
+			t.Fatalf("unexpected directories of %s (-want +got):\n%s", tc.release, diff)
+		}
+	}
+	// release directory shared by the whole namespace is never returned
+	cs.Defaults.ReleasePathTemplate = "{{.ReleasesPath}}/{{.ClusterName}}/{{.ReleaseNamespace}}"
+	dirs, err := cs.ReleaseDirectories(cs.ReleaseByName("prometheus"), false)
+	if err != nil {
+		t.Fatalf("failed to get directories of prometheus %v", err)
+	}
+	if len(dirs) != 0 {
+		t.Fatalf("expected shared release directory to be skipped, got %v", dirs)
+	}
+}
@@ -0,0 +1,440 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultIndent is used for the config files without nested mappings
+const defaultIndent = 2
+
+// ConfigEditor modifies the config file through the yaml node tree. Only the
+// changed entries are encoded on save, the rest of the file is copied as is, so
+// comments, empty lines, quoting and indentation are preserved. Indentation and
+// style of the block sequences of the file are detected on load and used for
+// the new entries
+type ConfigEditor struct {
+	path   string
+	mode   os.FileMode
+	indent int
+	// compactSeq is set if block sequences aren't indented under their keys
+	compactSeq bool
+	// docStart is set if the file starts with the explicit "---" marker
+	docStart bool
+	// data is the original content, lines are offsets of its lines
+	data  []byte
+	lines []int
+	// orig are copies of the loaded nodes
+	orig map[*yaml.Node]yaml.Node
+	root yaml.Node
+}
+
+// LoadConfigEditor reads the config file for modification
+func LoadConfigEditor(path string) (*ConfigEditor, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &ConfigEditor{
+		path:     path,
+		mode:     fi.Mode().Perm(),
+		docStart: bytes.HasPrefix(data, []byte("---")),
+		data:     data,
+		lines:    []int{0},
+		orig:     map[*yaml.Node]yaml.Node{},
+	}
+	if err = yaml.Unmarshal(data, &e.root); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	if e.root.Kind != yaml.DocumentNode || len(e.root.Content) == 0 || e.root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config %s is not a yaml mapping", path)
+	}
+	for i, b := range data {
+		if b == '\n' && i+1 < len(data) {
+			e.lines = append(e.lines, i+1)
+		}
+	}
+	e.indent = detectIndent(e.root.Content[0])
+	e.compactSeq = detectCompactSequences(e.root.Content[0])
+	snapshot(&e.root, e.orig)
+	return e, nil
+}
+
+// Save writes the config back to its location, the whole config
+// is encoded only if its structure doesn't match the original content
+func (e *ConfigEditor) Save() error {
+	data, ok, err := e.splice(e.root.Content[0], 0, len(e.data))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		var buf bytes.Buffer
+		if e.docStart {
+			buf.WriteString("---\n")
+		}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(e.indent)
+		if err := enc.Encode(&e.root); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	return ioutil.WriteFile(e.path, data, e.mode)
+}
+
+// AddRelease appends release to the config, only name, namespace,
+// chart, version and values of the release are written
+func (e *ConfigEditor) AddRelease(r ReleaseSpec) error {
+	releases, err := e.sequence("releases", false)
+	if err != nil {
+		return err
+	}
+	if findByName(releases, r.Name) != -1 {
+		return fmt.Errorf("release %s already exists in the config %s", r.Name, e.path)
+	}
+	m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setScalar(m, "name", r.Name)
+	updateRelease(m, r)
+	releases.Content = append(releases.Content, m)
+	return nil
+}
+
+// UpdateRelease replaces namespace, chart, version and values of the release
+// with the ones from the spec, keys which are empty in the spec are removed.
+// Other keys of the release are kept as is
+func (e *ConfigEditor) UpdateRelease(r ReleaseSpec) error {
+	m, err := e.release(r.Name)
+	if err != nil {
+		return err
+	}
+	updateRelease(m, r)
+	return nil
+}
+
+// RemoveRelease removes release from the config
+func (e *ConfigEditor) RemoveRelease(name string) error {
+	releases := mappingValue(e.root.Content[0], "releases")
+	i := findByName(releases, name)
+	if i == -1 {
+		return fmt.Errorf("release %s not found in the config %s", name, e.path)
+	}
+	releases.Content = append(releases.Content[:i], releases.Content[i+1:]...)
+	return nil
+}
+
+// SetReleaseVersion updates chart version of the release
+func (e *ConfigEditor) SetReleaseVersion(name, version string) error {
+	m, err := e.release(name)
+	if err != nil {
+		return err
+	}
+	setScalar(m, "version", version)
+	return nil
+}
+
+// AddRepository appends repository to the config, missing repositories
+// key is created at the beginning of the file
+func (e *ConfigEditor) AddRepository(r RepositorySpec) error {
+	repos, err := e.sequence("repositories", true)
+	if err != nil {
+		return err
+	}
+	if findByName(repos, r.Name) != -1 {
+		return fmt.Errorf("repository %s already exists in the config %s", r.Name, e.path)
+	}
+	m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setScalar(m, "name", r.Name)
+	updateRepository(m, r)
+	repos.Content = append(repos.Content, m)
+	return nil
+}
+
+// UpdateRepository replaces url and credentials of the repository with
+// the ones from the spec, keys which are empty in the spec are removed
+func (e *ConfigEditor) UpdateRepository(r RepositorySpec) error {
+	repos := mappingValue(e.root.Content[0], "repositories")
+	i := findByName(repos, r.Name)
+	if i == -1 {
+		return fmt.Errorf("repository %s not found in the config %s", r.Name, e.path)
+	}
+	updateRepository(repos.Content[i], r)
+	return nil
+}
+
+// RemoveRepository removes all the repositories with the name from the config
+func (e *ConfigEditor) RemoveRepository(name string) error {
+	repos := mappingValue(e.root.Content[0], "repositories")
+	if findByName(repos, name) == -1 {
+		return fmt.Errorf("repository %s not found in the config %s", name, e.path)
+	}
+	var kept []*yaml.Node
+	for _, r := range repos.Content {
+		if n := mappingValue(r, "name"); n != nil && n.Value == name {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	repos.Content = kept
+	return nil
+}
+
+// release returns mapping node of the release with the given name
+func (e *ConfigEditor) release(name string) (*yaml.Node, error) {
+	releases := mappingValue(e.root.Content[0], "releases")
+	i := findByName(releases, name)
+	if i == -1 {
+		return nil, fmt.Errorf("release %s not found in the config %s", name, e.path)
+	}
+	return releases.Content[i], nil
+}
+
+// sequence returns sequence node of the top level key, missing key
+// is created at the beginning or at the end of the document
+func (e *ConfigEditor) sequence(key string, first bool) (*yaml.Node, error) {
+	root := e.root.Content[0]
+	if v := mappingValue(root, key); v != nil {
+		switch {
+		case v.Kind == yaml.SequenceNode:
+			if len(v.Content) == 0 {
+				// items are written in the block style, e.g. instead of "releases: []"
+				v.Style &^= yaml.FlowStyle
+			}
+			return v, nil
+		case v.Kind == yaml.ScalarNode && v.Tag == "!!null":
+			// empty key, e.g. "releases:" without items
+			*v = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", HeadComment: v.HeadComment, LineComment: v.LineComment}
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s of the config %s is not a list", key, e.path)
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	if first {
+		// comment at the top of the file stays there
+		if len(root.Content) > 0 {
+			k.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+		}
+		root.Content = append([]*yaml.Node{k, v}, root.Content...)
+	} else {
+		root.Content = append(root.Content, k, v)
+	}
+	return v, nil
+}
+
+// updateRelease writes fields of the release managed by the editor
+func updateRelease(m *yaml.Node, r ReleaseSpec) {
+	setOrRemoveScalar(m, "namespace", r.Namespace)
+	setOrRemoveScalar(m, "chart", r.Chart)
+	setOrRemoveScalar(m, "version", r.Version)
+	setOrRemoveSequence(m, "values", r.Values)
+}
+
+// updateRepository writes fields of the repository managed by the editor
+func updateRepository(m *yaml.Node, r RepositorySpec) {
+	for _, kv := range [][2]string{
+		{"url", r.URL},
+		{"certFile", r.CertFile},
+		{"keyFile", r.KeyFile},
+		{"username", r.Username},
+		{"password", r.Password},
+		{"usernameEnv", r.UsernameEnv},
+		{"passwordEnv", r.PasswordEnv},
+		{"passwordFile", r.PasswordFile},
+	} {
+		setOrRemoveScalar(m, kv[0], kv[1])
+	}
+}
+
+// detectIndent returns indentation of the first nested block mapping or sequence
+func detectIndent(root *yaml.Node) int {
+	var walk func(n *yaml.Node) int
+	walk = func(n *yaml.Node) int {
+		if n.Kind != yaml.MappingNode || n.Style&yaml.FlowStyle != 0 {
+			return 0
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if v.Style&yaml.FlowStyle != 0 || len(v.Content) == 0 {
+				continue
+			}
+			switch v.Kind {
+			case yaml.MappingNode:
+				if v.Column > k.Column {
+					return v.Column - k.Column
+				}
+			case yaml.SequenceNode:
+				// indented sequence, the first item is placed after "- "
+				if v.Column > k.Column {
+					return v.Column - k.Column
+				}
+				if indent := walk(v.Content[0]); indent != 0 {
+					return indent
+				}
+			}
+			if indent := walk(v); indent != 0 {
+				return indent
+			}
+		}
+		return 0
+	}
+	if indent := walk(root); indent > 0 {
+		return indent
+	}
+	return defaultIndent
+}
+
+// findByName returns index of the mapping with the name in the sequence, -1 if it's missing
+func findByName(seq *yaml.Node, name string) int {
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return -1
+	}
+	for i, item := range seq.Content {
+		if n := mappingValue(item, "name"); n != nil && n.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue returns value node of the key or nil if it's missing
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setScalar sets value of the key in the mapping, missing key is appended
+func setScalar(m *yaml.Node, key, value string) {
+	if v := mappingValue(m, key); v != nil {
+		if v.Kind != yaml.ScalarNode {
+			v.Kind, v.Style, v.Content = yaml.ScalarNode, 0, nil
+		}
+		// quoting of the scalar is kept
+		v.Tag, v.Value = "!!str", value
+		return
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+}
+
+// setOrRemoveScalar sets value of the key, key is removed if value is empty
+func setOrRemoveScalar(m *yaml.Node, key, value string) {
+	if value == "" {
+		removeKey(m, key)
+		return
+	}
+	setScalar(m, key, value)
+}
+
+// setOrRemoveSequence sets list of strings as value of the key,
+// key is removed if the list is empty
+func setOrRemoveSequence(m *yaml.Node, key string, values []string) {
+	if len(values) == 0 {
+		removeKey(m, key)
+		return
+	}
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, v := range values {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+	}
+	if v := mappingValue(m, key); v != nil {
+		if v.Kind == yaml.SequenceNode && sameScalars(v, values) {
+			return
+		}
+		seq.Style = v.Style & yaml.FlowStyle
+		seq.HeadComment, seq.LineComment, seq.FootComment = v.HeadComment, v.LineComment, v.FootComment
+		*v = *seq
+		return
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, seq)
+}
+
+// sameScalars returns true if the sequence consists of the values
+func sameScalars(seq *yaml.Node, values []string) bool {
+	if len(seq.Content) != len(values) {
+		return false
+	}
+	for i, n := range seq.Content {
+		if n.Kind != yaml.ScalarNode || n.Value != values[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removeKey removes key and its value from the mapping
+func removeKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// editConfig loads the config file, applies the change and saves it back
+func editConfig(path string, change func(e *ConfigEditor) error) error {
+	e, err := LoadConfigEditor(path)
+	if err != nil {
+		return err
+	}
+	if err = change(e); err != nil {
+		return err
+	}
+	return e.Save()
+}
+
+// SetReleaseVersion updates chart version of the release in the config file,
+// comments and formatting of the rest of the file are preserved
+func SetReleaseVersion(path, release, version string) error {
+	return editConfig(path, func(e *ConfigEditor) error {
+		return e.SetReleaseVersion(release, version)
+	})
+}
+
+// AddRelease appends release to the config file
+func AddRelease(path string, release ReleaseSpec) error {
+	return editConfig(path, func(e *ConfigEditor) error {
+		return e.AddRelease(release)
+	})
+}
+
+// RemoveRelease removes release from the config file
+func RemoveRelease(path, name string) error {
+	return editConfig(path, func(e *ConfigEditor) error {
+		return e.RemoveRelease(name)
+	})
+}
+
+// AddRepository appends repository to the config file
+func AddRepository(path string, repo RepositorySpec) error {
+	return editConfig(path, func(e *ConfigEditor) error {
+		return e.AddRepository(repo)
+	})
+}
+
+// RemoveRepository removes all the repositories with the name from the config file
+func RemoveRepository(path, name string) error {
+	return editConfig(path, func(e *ConfigEditor) error {
+		return e.RemoveRepository(name)
+	})
+}
@@ -0,0 +1,184 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const writerTestConfig = `# cluster config
+defaults:
+  clusterName: dev # inline comment
+releases:
+  # monitoring
+  - name: prometheus
+    chart: stable/prometheus
+    version: 8.11.4
+  - name: cert-manager
+    chart: jetstack/cert-manager
+`
+
+func writeTestConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "test-writer")
+	if err != nil {
+		t.Fatalf("failed to create temp directory %v", err)
+	}
+	path := filepath.Join(dir, "kube-atlas.yaml")
+	if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config %v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestSetReleaseVersion(t *testing.T) {
+	path, cleanup := writeTestConfig(t, writerTestConfig)
+	defer cleanup()
+	if err := SetReleaseVersion(path, "prometheus", "8.12.0"); err != nil {
+		t.Fatalf("failed to update version %v", err)
+	}
+	if err := SetReleaseVersion(path, "cert-manager", "v0.9.1"); err != nil {
+		t.Fatalf("failed to add version %v", err)
+	}
+	if err := SetReleaseVersion(path, "missing", "1.0.0"); err == nil {
+		t.Fatalf("expected error for release missing from the config")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	exp := `# cluster config
+defaults:
+  clusterName: dev # inline comment
+releases:
+  # monitoring
+  - name: prometheus
+    chart: stable/prometheus
+    version: 8.12.0
+  - name: cert-manager
+    chart: jetstack/cert-manager
+    version: v0.9.1
+`
+	if diff := cmp.Diff(exp, string(data)); diff != "" {
+		t.Fatalf("unexpected config content (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddRemoveRepository(t *testing.T) {
+	path, cleanup := writeTestConfig(t, writerTestConfig)
+	defer cleanup()
+	if err := AddRepository(path, RepositorySpec{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"}); err != nil {
+		t.Fatalf("failed to add repository %v", err)
+	}
+	if err := AddRepository(path, RepositorySpec{Name: "private", URL: "https://charts.local", Username: "user"}); err != nil {
+		t.Fatalf("failed to add repository %v", err)
+	}
+	if err := AddRepository(path, RepositorySpec{Name: "stable", URL: "https://example.com"}); err == nil {
+		t.Fatalf("expected error for duplicate repository")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	// comment at the top of the file stays above the new repositories
+	exp := `# cluster config
+repositories:
+  - name: stable
+    url: https://kubernetes-charts.storage.googleapis.com
+  - name: private
+    url: https://charts.local
+    username: user
+` + strings.TrimPrefix(writerTestConfig, "# cluster config\n")
+	if diff := cmp.Diff(exp, string(data)); diff != "" {
+		t.Fatalf("unexpected config content (-want +got):\n%s", diff)
+	}
+	if err = RemoveRepository(path, "stable"); err != nil {
+		t.Fatalf("failed to remove repository %v", err)
+	}
+	if err = RemoveRepository(path, "stable"); err == nil {
+		t.Fatalf("expected error for removing missing repository")
+	}
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	exp = `# cluster config
+repositories:
+  - name: private
+    url: https://charts.local
+    username: user
+` + strings.TrimPrefix(writerTestConfig, "# cluster config\n")
+	if diff := cmp.Diff(exp, string(data)); diff != "" {
+		t.Fatalf("unexpected config content (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemoveRelease(t *testing.T) {
+	path, cleanup := writeTestConfig(t, writerTestConfig)
+	defer cleanup()
+	if err := RemoveRelease(path, "cert-manager"); err != nil {
+		t.Fatalf("failed to remove release %v", err)
+	}
+	if err := RemoveRelease(path, "cert-manager"); err == nil {
+		t.Fatalf("expected error for removing missing release")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	exp := `# cluster config
+defaults:
+  clusterName: dev # inline comment
+releases:
+  # monitoring
+  - name: prometheus
+    chart: stable/prometheus
+    version: 8.11.4
+`
+	if diff := cmp.Diff(exp, string(data)); diff != "" {
+		t.Fatalf("unexpected config content (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddRelease(t *testing.T) {
+	path, cleanup := writeTestConfig(t, writerTestConfig)
+	defer cleanup()
+	release := ReleaseSpec{Name: "grafana", Namespace: "monitoring", Chart: "stable/grafana", Version: "3.5.0", Values: []string{"values.yaml"}}
+	if err := AddRelease(path, release); err != nil {
+		t.Fatalf("failed to add release %v", err)
+	}
+	if err := AddRelease(path, ReleaseSpec{Name: "prometheus"}); err == nil {
+		t.Fatalf("expected error for duplicate release")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	exp := writerTestConfig + `  - name: grafana
+    namespace: monitoring
+    chart: stable/grafana
+    version: 3.5.0
+    values:
+      - values.yaml
+`
+	if diff := cmp.Diff(exp, string(data)); diff != "" {
+		t.Fatalf("unexpected config content (-want +got):\n%s", diff)
+	}
+
+	// releases key is created if missing
+	path, cleanup = writeTestConfig(t, "defaults:\n  clusterName: dev\n")
+	defer cleanup()
+	if err = AddRelease(path, ReleaseSpec{Name: "grafana"}); err != nil {
+		t.Fatalf("failed to add release %v", err)
+	}
+	if data, err = ioutil.ReadFile(path); err != nil {
+		t.Fatalf("failed to read config %v", err)
+	}
+	exp = "defaults:\n  clusterName: dev\nreleases:\n  - name: grafana\n"
+	if diff := cmp.Diff(exp, string(data)); diff != "" {
+		t.Fatalf("unexpected config content (-want +got):\n%s", diff)
+	}
+}